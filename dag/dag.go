@@ -11,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/HORNET-Storage/scionic-merkletree/merkletree"
+
 	cbor "github.com/fxamacker/cbor/v2"
 )
 
@@ -73,8 +75,10 @@ func CreateDagAdvanced(path string, additionalData map[string]string) (*Dag, err
 }
 
 func createDag(path string, additionalData map[string]string) (*Dag, error) {
-	dag := CreateDagBuilder()
+	return createDagWith(CreateDagBuilder(), path, additionalData)
+}
 
+func createDagWith(dag *DagBuilder, path string, additionalData map[string]string) (*Dag, error) {
 	fileInfo, err := os.Stat(path)
 	if err != nil {
 		return nil, err
@@ -87,6 +91,17 @@ func createDag(path string, additionalData map[string]string) (*Dag, error) {
 
 	parentPath := filepath.Dir(path)
 
+	// Only a file that decodes as a manifest is left out, any other .dag file is kept
+	if fileInfo.IsDir() {
+		_, err := ReadManifest(path)
+		dag.skipManifest = err == nil
+	}
+
+	if Concurrency > 1 {
+		dag.hashes = startHashPool(path, dag, Concurrency)
+		defer dag.hashes.close()
+	}
+
 	var leaf *DagLeaf
 
 	if fileInfo.IsDir() {
@@ -110,6 +125,20 @@ func processEntry(entry fs.DirEntry, path *string, dag *DagBuilder) (*DagLeaf, e
 	var result *DagLeaf
 	var err error
 
+	if entry.Type()&fs.ModeSymlink != 0 {
+		switch SymlinkHandling {
+		case SkipSymlinks:
+			return nil, nil
+		case PreserveSymlinks:
+			return processSymlink(entry, path)
+		}
+
+		entry, err = newDirEntry(filepath.Join(*path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if entry.IsDir() {
 		result, err = processDirectory(entry, path, dag, false, nil)
 	} else {
@@ -135,7 +164,30 @@ func processDirectory(entry fs.DirEntry, path *string, dag *DagBuilder, isRoot b
 
 	builder.SetType(DirectoryLeafType)
 
-	entries, err := os.ReadDir(entryPath)
+	err = setMetadata(builder, entryPath, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if SymlinkHandling == FollowSymlinks {
+		realPath, err := filepath.EvalSymlinks(entryPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if dag.directories == nil {
+			dag.directories = map[string]bool{}
+		}
+
+		if dag.directories[realPath] {
+			return nil, fmt.Errorf("symlink loop at %s", entryPath)
+		}
+
+		dag.directories[realPath] = true
+		defer delete(dag.directories, realPath)
+	}
+
+	entries, err := dag.readDir(entryPath)
 	if err != nil {
 		return nil, err
 	}
@@ -143,11 +195,26 @@ func processDirectory(entry fs.DirEntry, path *string, dag *DagBuilder, isRoot b
 	var result *DagLeaf
 
 	for _, entry := range entries {
+		// The manifest of an extracted directory is not part of its dag
+		if isRoot && dag.skipManifest && entry.Name() == ManifestFileName {
+			continue
+		}
+
 		leaf, err := processEntry(entry, &entryPath, dag)
+
+		// Frees the chunks hashed ahead for the entry, they are in the dag now or no longer needed
+		if dag.hashes != nil {
+			dag.hashes.release(filepath.Join(entryPath, entry.Name()))
+		}
+
 		if err != nil {
 			return nil, err
 		}
 
+		if leaf == nil {
+			continue
+		}
+
 		label := dag.GetNextAvailableLabel()
 		builder.AddLink(label, leaf.Hash)
 		leaf.SetLabel(label)
@@ -181,12 +248,60 @@ func processFile(entry fs.DirEntry, path *string, dag *DagBuilder, isRoot bool,
 
 	builder.SetType(FileLeafType)
 
-	fileData, err := os.ReadFile(entryPath)
+	err = setMetadata(builder, entryPath, entry)
 	if err != nil {
 		return nil, err
 	}
 
-	builder.SetType(FileLeafType)
+	reused := false
+	if dag.cache != nil {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		reused, err = dag.cache.reuseFile(builder, entryPath, info, dag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !reused {
+		err = addFileChunks(builder, relPath, entryPath, dag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if isRoot {
+		result, err = builder.BuildRootLeaf(dag, additionalData)
+	} else {
+		result, err = builder.BuildLeaf(nil)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dag.cache != nil {
+		dag.cache.record(entryPath, result)
+	}
+
+	return result, nil
+}
+
+func addFileChunks(builder *DagLeafBuilder, relPath string, entryPath string, dag *DagBuilder) error {
+	if dag.hashes != nil {
+		if file := dag.hashes.file(entryPath); file != nil {
+			file.addTo(builder, dag)
+			return nil
+		}
+	}
+
+	fileData, err := os.ReadFile(entryPath)
+	if err != nil {
+		return err
+	}
 
 	fileChunks := chunkFile(fileData, ChunkSize)
 
@@ -202,7 +317,7 @@ func processFile(entry fs.DirEntry, path *string, dag *DagBuilder, isRoot bool,
 
 			chunkLeaf, err := chunkBuilder.BuildLeaf(nil)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			label := dag.GetNextAvailableLabel()
@@ -212,17 +327,42 @@ func processFile(entry fs.DirEntry, path *string, dag *DagBuilder, isRoot bool,
 		}
 	}
 
-	if isRoot {
-		result, err = builder.BuildRootLeaf(dag, additionalData)
-	} else {
-		result, err = builder.BuildLeaf(nil)
-	}
+	return nil
+}
 
+// Symlinks keep no metadata as their mode and times can not be restored on every platform
+func processSymlink(entry fs.DirEntry, path *string) (*DagLeaf, error) {
+	target, err := os.Readlink(filepath.Join(*path, entry.Name()))
 	if err != nil {
 		return nil, err
 	}
 
-	return result, nil
+	builder := CreateDagLeafBuilder(entry.Name())
+
+	builder.SetType(SymlinkLeafType)
+	builder.SetData([]byte(target))
+
+	return builder.BuildLeaf(nil)
+}
+
+func setMetadata(builder *DagLeafBuilder, path string, entry fs.DirEntry) error {
+	if RecordedMetadata == 0 {
+		return nil
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		return err
+	}
+
+	metadata, err := readMetadata(path, info, RecordedMetadata)
+	if err != nil {
+		return err
+	}
+
+	builder.SetMetadata(metadata)
+
+	return nil
 }
 
 func chunkFile(fileData []byte, chunkSize int) [][]byte {
@@ -246,6 +386,15 @@ func CreateDagBuilder() *DagBuilder {
 	}
 }
 
+// Parallel builds take the listing from the hash pool, so every directory is only read once
+func (b *DagBuilder) readDir(path string) ([]fs.DirEntry, error) {
+	if b.hashes != nil {
+		return b.hashes.readDir(path)
+	}
+
+	return os.ReadDir(path)
+}
+
 func (b *DagBuilder) AddLeaf(leaf *DagLeaf, parentLeaf *DagLeaf) error {
 	if parentLeaf != nil {
 		label := GetLabel(leaf.Hash)
@@ -295,54 +444,77 @@ func (dag *Dag) Verify() error {
 	return nil
 }
 
+// Writes the dag to path through a staging path the same way Extract does. Unlike Extract, path
+// may already exist, the entries of the dag are then moved into it once all of them are written.
+// They replace existing entries with the same names and are merged into existing directories
 func (dag *Dag) CreateDirectory(path string) error {
-	rootHash := dag.Root
-	rootLeaf := dag.Leafs[rootHash]
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return dag.Extract(path, nil)
+	}
 
-	err := rootLeaf.CreateDirectoryLeaf(path, dag)
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(filepath.Clean(path)), "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(tmpDir)
 
-	/*
-		cborData, err := dag.ToCBOR()
-		if err != nil {
-			log.Println("Failed to serialize dag into cbor")
-			os.Exit(1)
-		}
+	staged := filepath.Join(tmpDir, rootLeaf.ItemName)
+	err = dag.Extract(staged, nil)
+	if err != nil {
+		return err
+	}
 
-		fileName := filepath.Join(path, ".dag")
-		file, err := os.Create(fileName)
-		if err != nil {
-			return err
-		}
+	err = moveInto(staged, path)
+	if err != nil {
+		return err
+	}
+
+	// Moving the entries changed the modification time of the directory
+	return rootLeaf.Metadata.restore(path, &ExtractOptions{})
+}
 
-		defer file.Close()
+// Moves src to dest, directories are merged into existing directories and anything else replaces
+// what is at dest
+func moveInto(src string, dest string) error {
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	destInfo, err := os.Lstat(dest)
+	if os.IsNotExist(err) {
+		return os.Rename(src, dest)
+	}
 
-		_, err = file.Write(cborData)
+	if err != nil {
+		return err
+	}
+
+	if !srcInfo.IsDir() || !destInfo.IsDir() {
+		err = os.RemoveAll(dest)
 		if err != nil {
-			return fmt.Errorf("failed to write to file: %w", err)
+			return err
 		}
-	*/
 
-	/*
-		if runtime.GOOS == "windows" {
-			p, err := syscall.UTF16PtrFromString(fileName)
-			if err != nil {
-				log.Fatal(err)
-			}
+		return os.Rename(src, dest)
+	}
 
-			attrs, err := syscall.GetFileAttributes(p)
-			if err != nil {
-				log.Fatal(err)
-			}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
 
-			err = syscall.SetFileAttributes(p, attrs|syscall.FILE_ATTRIBUTE_HIDDEN)
-			if err != nil {
-				log.Fatal(err)
-			}
+	for _, entry := range entries {
+		err = moveInto(filepath.Join(src, entry.Name()), filepath.Join(dest, entry.Name()))
+		if err != nil {
+			return err
 		}
-	*/
+	}
 
 	return nil
 }
@@ -426,3 +598,19 @@ func (d *Dag) IterateDag(processLeaf func(leaf *DagLeaf, parent *DagLeaf) error)
 
 	return iterate(d.Root, nil)
 }
+
+// Every leaf hash of the dag, root first and then in label order, as a ["string"] value of an
+// OpenZeppelin standard merkle tree so the dag can be anchored and its leaves proven in a smart contract
+func (d *Dag) StandardMerkleTree() (*merkletree.StandardTree, error) {
+	values := [][]interface{}{}
+
+	err := d.IterateDag(func(leaf *DagLeaf, parent *DagLeaf) error {
+		values = append(values, []interface{}{leaf.Hash})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return merkletree.NewStandardTree(values, []string{"string"})
+}
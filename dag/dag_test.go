@@ -1,6 +1,7 @@
 package dag
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -137,3 +138,118 @@ func TestPartial(t *testing.T) {
 		t.Fatal("Error: ", err)
 	}
 }
+
+func TestRangeBranch(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	input := filepath.Join(tmpDir, "input")
+	err = os.Mkdir(input, 0755)
+	if err != nil {
+		t.Fatalf("Could not create input directory: %s", err)
+	}
+
+	for i := 0; i < 12; i++ {
+		err = ioutil.WriteFile(filepath.Join(input, fmt.Sprintf("file%d.txt", i)), []byte(fmt.Sprintf("content %d", i)), 0644)
+		if err != nil {
+			t.Fatalf("Could not write file: %s", err)
+		}
+	}
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	rootLeaf := dag.Leafs[dag.Root]
+
+	branch, err := rootLeaf.GetIndexRangeBranch(3, 9)
+	if err != nil {
+		t.Fatalf("Failed to retrieve range branch: %s", err)
+	}
+
+	err = rootLeaf.VerifyRangeBranch(branch)
+	if err != nil {
+		t.Fatalf("Failed to verify range branch: %s", err)
+	}
+
+	// Withholding a child from the range must be detected
+	branch.Leaves = append(branch.Leaves[:2], branch.Leaves[3:]...)
+	branch.Proof.End--
+
+	err = rootLeaf.VerifyRangeBranch(branch)
+	if err == nil {
+		t.Fatal("Range branch with a withheld child verified")
+	}
+
+	// Children are labelled 2-13, so 10-12 sort before "2" in the tree and 2-4 follow them
+	for _, span := range [][2]int{{10, 12}, {2, 4}} {
+		branch, err = rootLeaf.GetLabelRangeBranch(span[0], span[1])
+		if err != nil {
+			t.Fatalf("Failed to retrieve label range branch: %s", err)
+		}
+
+		err = rootLeaf.VerifyLabelRangeBranch(branch, span[0], span[1])
+		if err != nil {
+			t.Fatalf("Failed to verify label range branch: %s", err)
+		}
+	}
+
+	err = rootLeaf.VerifyLabelRangeBranch(branch, 2, 5)
+	if err == nil {
+		t.Fatal("Label range branch verified for a larger span")
+	}
+
+	// "9" sorts after "13", so 9-11 crosses a digit boundary and is not contiguous
+	_, err = rootLeaf.GetLabelRangeBranch(9, 11)
+	if err == nil {
+		t.Fatal("Label range branch over a span that is not contiguous was created")
+	}
+
+	_, err = rootLeaf.GetLabelRangeBranch(12, 14)
+	if err == nil {
+		t.Fatal("Label range branch over a missing label was created")
+	}
+}
+
+// Creates a temporary directory, removed when the test ends, with an input directory holding the
+// files by slash separated path. Returns the temporary directory and the input directory
+func createTestInput(t *testing.T, files map[string]string) (string, string) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %s", err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(tmpDir)
+	})
+
+	input := filepath.Join(tmpDir, "input")
+	err = os.Mkdir(input, 0755)
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+
+	for name, content := range files {
+		writeTestFile(t, filepath.Join(input, filepath.FromSlash(name)), content)
+	}
+
+	return tmpDir, input
+}
+
+// Writes the file, creating its parent directories
+func writeTestFile(t *testing.T, path string, content string) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+
+	err = ioutil.WriteFile(path, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("Could not write file: %s", err)
+	}
+}
@@ -0,0 +1,288 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Returns a copy of the dag whose root also commits prevRoot and the CIDs or paths deleted since it.
+// Paths are relative to the previous root, sign the result to publish its deletion manifest
+func (dag *Dag) CommitDeletions(prevRoot string, deleted []string) (*Dag, error) {
+	if len(deleted) == 0 {
+		return nil, fmt.Errorf("no deletions to commit")
+	}
+
+	if HasLabel(prevRoot) {
+		return nil, fmt.Errorf("previous root %s is not a root", prevRoot)
+	}
+
+	_, err := cid.Decode(prevRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid previous root: %w", err)
+	}
+
+	unique := map[string]bool{}
+	metaData := MetaData{Deleted: []string{}}
+	for _, entry := range deleted {
+		if !unique[entry] {
+			unique[entry] = true
+			metaData.Deleted = append(metaData.Deleted, entry)
+		}
+	}
+	sort.Strings(metaData.Deleted)
+
+	encoded, err := json.Marshal(metaData)
+	if err != nil {
+		return nil, err
+	}
+
+	editor, rootLeaf, err := dag.newEditor()
+	if err != nil {
+		return nil, err
+	}
+
+	additionalData := map[string]string{}
+	for key, value := range rootLeaf.AdditionalData {
+		additionalData[key] = value
+	}
+	additionalData[PreviousRootKey] = prevRoot
+	additionalData[DeletedKey] = string(encoded)
+
+	return editor.buildDag(rootLeaf, copyLinks(rootLeaf.Links), additionalData)
+}
+
+// Nil when the root does not commit any deletions
+func (dag *Dag) DeletionManifest() (*DeletionManifest, error) {
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return nil, fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	if _, exists := rootLeaf.AdditionalData[DeletedKey]; !exists {
+		return nil, nil
+	}
+
+	// The manifest travels without the rest of the dag
+	manifestRoot := rootLeaf.Clone()
+	manifestRoot.Links = map[string]string{}
+
+	manifest := &DeletionManifest{
+		RootLeaf:   manifestRoot,
+		Signatures: dag.Signatures,
+	}
+
+	err := manifest.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+func (manifest *DeletionManifest) parse() error {
+	if manifest.RootLeaf == nil {
+		return fmt.Errorf("deletion manifest has no root leaf")
+	}
+
+	encoded, exists := manifest.RootLeaf.AdditionalData[DeletedKey]
+	if !exists {
+		return fmt.Errorf("root %s does not commit any deletions", manifest.RootLeaf.Hash)
+	}
+
+	var metaData MetaData
+	err := json.Unmarshal([]byte(encoded), &metaData)
+	if err != nil {
+		return fmt.Errorf("could not decode deletions: %w", err)
+	}
+
+	manifest.Root = manifest.RootLeaf.Hash
+	manifest.PreviousRoot = manifest.RootLeaf.AdditionalData[PreviousRootKey]
+	manifest.MetaData = metaData
+
+	return nil
+}
+
+// Checks that the deletions are committed by the root leaf and that the root is signed by one of
+// the trusted public keys, the parsed fields are replaced by the ones committed by the root leaf
+func (manifest *DeletionManifest) Verify(pubkeys ...[]byte) error {
+	if manifest.RootLeaf == nil {
+		return fmt.Errorf("deletion manifest has no root leaf")
+	}
+
+	err := manifest.RootLeaf.VerifyRootLeaf()
+	if err != nil {
+		return err
+	}
+
+	err = manifest.parse()
+	if err != nil {
+		return err
+	}
+
+	if manifest.PreviousRoot == "" {
+		return fmt.Errorf("deletion manifest does not link to a previous root")
+	}
+
+	return verifyRootSignatures(manifest.Root, manifest.Signatures, pubkeys)
+}
+
+// Splits the deleted entries into hashes and paths. A labelled hash names a single leaf, a bare CID
+// every leaf with that CID
+func (metaData *MetaData) deletedEntries() (map[string]bool, map[string]bool) {
+	hashes := map[string]bool{}
+	paths := map[string]bool{}
+
+	for _, entry := range metaData.Deleted {
+		if _, err := cid.Decode(GetHash(entry)); err == nil {
+			hashes[entry] = true
+		} else {
+			paths[cleanDagPath(entry)] = true
+		}
+	}
+
+	return hashes, paths
+}
+
+func matchesDeleted(hashes map[string]bool, hash string) bool {
+	return hashes[hash] || hashes[GetHash(hash)]
+}
+
+// Collects the labelled hashes of the leaves a manifest deletes from the previous revision. Leaves
+// are matched within that revision only, so a leaf that merely shares a CID with a deleted one, like
+// a chunk of identical content, is kept. A file loses all of its chunks or none
+func (dag *Dag) deletedLeafs(metaData *MetaData) (map[string]bool, error) {
+	hashes, paths := metaData.deletedEntries()
+	deleted := map[string]bool{}
+
+	var collect func(hash string)
+	collect = func(hash string) {
+		if deleted[hash] {
+			return
+		}
+		deleted[hash] = true
+
+		leaf, exists := dag.Leafs[hash]
+		if !exists {
+			return
+		}
+
+		for _, link := range leaf.Links {
+			collect(link)
+		}
+	}
+
+	for hash := range dag.Leafs {
+		if matchesDeleted(hashes, hash) {
+			collect(hash)
+		}
+	}
+
+	for entryPath := range paths {
+		leaf, err := dag.leafAtPath(entryPath)
+		if err != nil {
+			// The path may have been deleted from the previous revision already
+			continue
+		}
+
+		collect(leaf.Hash)
+	}
+
+	for hash, leaf := range dag.Leafs {
+		if leaf.Type != FileLeafType || deleted[hash] {
+			continue
+		}
+
+		for _, link := range leaf.Links {
+			if deleted[link] {
+				collect(hash)
+				break
+			}
+		}
+	}
+
+	return deleted, nil
+}
+
+// Copy of the dag without the deleted leaves, by labelled hash. Their parents are kept without the
+// links to them the same way partial dags are
+func (dag *Dag) withoutLeafs(deleted map[string]bool) *Dag {
+	result := &Dag{
+		Root:       dag.Root,
+		Leafs:      map[string]*DagLeaf{},
+		Signatures: dag.Signatures,
+	}
+
+	for hash, leaf := range dag.Leafs {
+		if deleted[hash] {
+			continue
+		}
+
+		pruned := leaf
+		for label, link := range leaf.Links {
+			if !deleted[link] {
+				continue
+			}
+
+			if pruned == leaf {
+				pruned = leaf.Clone()
+				pruned.Links = copyLinks(leaf.Links)
+			}
+
+			delete(pruned.Links, label)
+		}
+
+		result.Leafs[hash] = pruned
+	}
+
+	return result
+}
+
+func (dag *Dag) leafAtPath(entryPath string) (*DagLeaf, error) {
+	dir, name, err := splitDagPath(entryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return nil, fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	for _, component := range append(dir, name) {
+		leaf = dag.childByName(leaf, component)
+		if leaf == nil {
+			return nil, fmt.Errorf("%s does not exist in dag", entryPath)
+		}
+	}
+
+	return leaf, nil
+}
+
+// Children missing from a partial dag are skipped
+func (dag *Dag) childByName(leaf *DagLeaf, name string) *DagLeaf {
+	for _, link := range leaf.Links {
+		child, exists := dag.Leafs[link]
+		if exists && child.ItemName == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func cleanDagPath(entryPath string) string {
+	dir, name, err := splitDagPath(entryPath)
+	if err != nil {
+		return entryPath
+	}
+
+	result := name
+	for i := len(dir) - 1; i >= 0; i-- {
+		result = dir[i] + "/" + result
+	}
+
+	return result
+}
@@ -0,0 +1,326 @@
+package dag
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeletions(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{
+		"keep.txt":        "keep",
+		"secret.txt":      "secret",
+		"private/key.txt": "key",
+	})
+
+	previous, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	secret, err := previous.leafAtPath("secret.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	key, err := previous.leafAtPath("private/key.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	edited, err := previous.Remove("secret.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	edited, err = edited.Remove("private")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	revision, err := edited.CommitDeletions(previous.Root, []string{"private", secret.Hash, "private"})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = revision.Verify()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if revision.PreviousRoot() != previous.Root {
+		t.Fatal("Revision does not link to the previous root")
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	signer := NewEd25519Signer(privateKey)
+
+	err = revision.Sign(signer)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	manifest, err := revision.DeletionManifest()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if manifest == nil || len(manifest.Deleted) != 2 || manifest.PreviousRoot != previous.Root {
+		t.Fatalf("Unexpected deletion manifest %v", manifest)
+	}
+
+	err = manifest.Verify(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if manifest.Verify(NewEd25519Signer(otherKey).PublicKey()) == nil {
+		t.Fatal("Manifest verified against an untrusted key")
+	}
+
+	tampered := *manifest
+	tampered.RootLeaf = manifest.RootLeaf.Clone()
+	tampered.RootLeaf.AdditionalData = map[string]string{
+		PreviousRootKey: previous.Root,
+		DeletedKey:      `{"Deleted":["keep.txt"]}`,
+	}
+	if tampered.Verify(signer.PublicKey()) == nil {
+		t.Fatal("Manifest with tampered deletions verified")
+	}
+
+	manifest, err = previous.DeletionManifest()
+	if err != nil || manifest != nil {
+		t.Fatal("Dag without deletions returned a manifest")
+	}
+
+	// Later edits are revisions of the dag they were edited from and commit no deletions of their own
+	next, err := revision.PutFile("c.txt", strings.NewReader("c"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	manifest, err = next.DeletionManifest()
+	if err != nil || manifest != nil {
+		t.Fatal("Edit of a revision committed its deletions again")
+	}
+
+	if next.PreviousRoot() != revision.Root {
+		t.Fatal("Edit of a revision does not link to the dag it was edited from")
+	}
+
+	// Diffs show the committed deletions as tombstones
+	diff, err := Diff(previous, revision)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(diff.Entries) != 2 {
+		t.Fatalf("Expected 2 diff entries, got %d", len(diff.Entries))
+	}
+
+	for _, entry := range diff.Entries {
+		if entry.Type != TombstoneDiff {
+			t.Fatalf("Deleted %s is reported as %s", entry.Path, entry.Type)
+		}
+	}
+
+	// Stores stop serving the deleted leaves
+	store := NewMemoryDagStore()
+
+	err = store.PutDag(previous)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = store.PutDag(revision)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	manifest, err = revision.DeletionManifest()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if store.ApplyDeletionManifest(manifest) == nil {
+		t.Fatal("Store applied a manifest without trusted keys")
+	}
+
+	err = store.ApplyDeletionManifest(manifest, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	stored, err := store.GetDag(previous.Root)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if _, exists := stored.Leafs[secret.Hash]; exists {
+		t.Fatal("Store still serves a deleted CID")
+	}
+
+	if _, exists := stored.Leafs[key.Hash]; exists {
+		t.Fatal("Store still serves a leaf below a deleted path")
+	}
+
+	if _, err := stored.leafAtPath("keep.txt"); err != nil {
+		t.Fatal("Store dropped a leaf that was not deleted")
+	}
+
+	err = stored.Verify()
+	if err != nil {
+		t.Fatalf("Pruned dag failed to verify: %s", err)
+	}
+
+	if _, exists := previous.Leafs[secret.Hash]; !exists {
+		t.Fatal("Store pruned the dag it was given")
+	}
+
+	stored, err = store.GetDag(revision.Root)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(stored.Leafs) != len(revision.Leafs) {
+		t.Fatal("Store dropped leaves of the revision that deleted them")
+	}
+
+	// Deletions only apply to the lineage of the manifest, not to identical leaves elsewhere
+	unrelatedInput := filepath.Join(tmpDir, "unrelated")
+	writeTestFile(t, filepath.Join(unrelatedInput, "secret.txt"), "secret")
+
+	unrelated, err := CreateDag(unrelatedInput, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	readded, err := revision.PutFile("secret.txt", strings.NewReader("secret"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, dag := range []*Dag{unrelated, readded} {
+		err = store.PutDag(dag)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		stored, err = store.GetDag(dag.Root)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		if len(stored.Leafs) != len(dag.Leafs) {
+			t.Fatal("Store hid leaves of a dag outside the lineage of the manifest")
+		}
+	}
+}
+
+func TestDeletionOfIdenticalFiles(t *testing.T) {
+	SetChunkSize(8)
+	defer SetChunkSize(4096)
+
+	// Files with the same name and content share their CIDs, files with the same content their chunks
+	tmpDir, input := createTestInput(t, map[string]string{
+		"a/same.txt": "content shared by both files",
+		"b/same.txt": "content shared by both files",
+		"copy.txt":   "content shared by both files",
+		"other.txt":  "content shared by both files",
+	})
+
+	previous, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	edited, err := previous.Remove("a/same.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	edited, err = edited.Remove("copy.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	revision, err := edited.CommitDeletions(previous.Root, []string{"a/same.txt", "copy.txt"})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	signer := NewEd25519Signer(privateKey)
+
+	err = revision.Sign(signer)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	manifest, err := revision.DeletionManifest()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// The revision deleting them is not in the store, so nothing keeps the shared CIDs alive
+	store := NewMemoryDagStore()
+
+	err = store.PutDag(previous)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = store.ApplyDeletionManifest(manifest, signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	stored, err := store.GetDag(previous.Root)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, deleted := range []string{"a/same.txt", "copy.txt"} {
+		if _, err := stored.leafAtPath(deleted); err == nil {
+			t.Fatalf("Store still serves the deleted %s", deleted)
+		}
+	}
+
+	err = stored.Verify()
+	if err != nil {
+		t.Fatalf("Pruned dag failed to verify: %s", err)
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = stored.Extract(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, kept := range []string{"b/same.txt", "other.txt"} {
+		content, err := os.ReadFile(filepath.Join(output, filepath.FromSlash(kept)))
+		if err != nil {
+			t.Fatalf("Identical file %s was not kept: %s", kept, err)
+		}
+
+		if string(content) != "content shared by both files" {
+			t.Fatalf("Identical file %s has the content %q", kept, content)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package dag
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+)
+
+type DiffType string
+
+const (
+	AddedDiff    DiffType = "added"
+	RemovedDiff  DiffType = "removed"
+	ModifiedDiff DiffType = "modified"
+	MovedDiff    DiffType = "moved"
+	// Removed entries, or entries of b's deletion manifest that match none of them, whose Path is then the entry itself
+	TombstoneDiff DiffType = "tombstone"
+)
+
+// Paths are relative to the roots, an added or removed directory is a single entry
+type DiffEntry struct {
+	Type    DiffType
+	Path    string
+	OldPath string
+	Leaf    *DagLeaf
+	OldLeaf *DagLeaf
+}
+
+type DagDiff struct {
+	Entries  []DiffEntry
+	NewLeafs map[string]*DagLeaf
+}
+
+// Compares the trees of a and b by item name, skipping every subtree whose CID is the same in both.
+// Entries removed from a and added to b with the same content are reported as moves, entries deleted
+// by the manifest of b as tombstones, and NewLeafs holds the leaves of b whose CID is not in a
+func Diff(a *Dag, b *Dag) (*DagDiff, error) {
+	rootA, exists := a.Leafs[a.Root]
+	if !exists {
+		return nil, fmt.Errorf("root %s is missing from dag", a.Root)
+	}
+
+	rootB, exists := b.Leafs[b.Root]
+	if !exists {
+		return nil, fmt.Errorf("root %s is missing from dag", b.Root)
+	}
+
+	result := &DagDiff{
+		NewLeafs: map[string]*DagLeaf{},
+	}
+
+	err := diffLeaf("", rootA, rootB, a, b, result)
+	if err != nil {
+		return nil, err
+	}
+
+	err = markTombstones(result, b)
+	if err != nil {
+		return nil, err
+	}
+
+	err = detectMoves(result, a, b)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result.Entries, func(i, j int) bool {
+		return result.Entries[i].Path < result.Entries[j].Path
+	})
+
+	known := map[string]bool{}
+	for hash := range a.Leafs {
+		known[GetHash(hash)] = true
+	}
+
+	err = collectNewLeafs(b.Root, b, known, result.NewLeafs)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func diffLeaf(entryPath string, leafA *DagLeaf, leafB *DagLeaf, a *Dag, b *Dag, result *DagDiff) error {
+	if GetHash(leafA.Hash) == GetHash(leafB.Hash) {
+		return nil
+	}
+
+	if leafA.Type != DirectoryLeafType || leafB.Type != DirectoryLeafType {
+		result.Entries = append(result.Entries, DiffEntry{
+			Type:    ModifiedDiff,
+			Path:    entryPath,
+			Leaf:    leafB,
+			OldLeaf: leafA,
+		})
+
+		return nil
+	}
+
+	childrenA, err := childrenByName(leafA, a)
+	if err != nil {
+		return err
+	}
+
+	childrenB, err := childrenByName(leafB, b)
+	if err != nil {
+		return err
+	}
+
+	for name, childA := range childrenA {
+		childPath := path.Join(entryPath, name)
+
+		childB, exists := childrenB[name]
+		if !exists {
+			result.Entries = append(result.Entries, DiffEntry{
+				Type:    RemovedDiff,
+				Path:    childPath,
+				OldLeaf: childA,
+			})
+
+			continue
+		}
+
+		err := diffLeaf(childPath, childA, childB, a, b, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	for name, childB := range childrenB {
+		if _, exists := childrenA[name]; !exists {
+			result.Entries = append(result.Entries, DiffEntry{
+				Type: AddedDiff,
+				Path: path.Join(entryPath, name),
+				Leaf: childB,
+			})
+		}
+	}
+
+	return nil
+}
+
+func markTombstones(result *DagDiff, b *Dag) error {
+	manifest, err := b.DeletionManifest()
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	hashes, paths := manifest.deletedEntries()
+	matched := map[string]bool{}
+
+	for i, entry := range result.Entries {
+		if entry.Type != RemovedDiff {
+			continue
+		}
+
+		if paths[entry.Path] || matchesDeleted(hashes, entry.OldLeaf.Hash) {
+			result.Entries[i].Type = TombstoneDiff
+			matched[entry.Path] = true
+			matched[entry.OldLeaf.Hash] = true
+			matched[GetHash(entry.OldLeaf.Hash)] = true
+		}
+	}
+
+	for _, deleted := range manifest.Deleted {
+		if matched[cleanDagPath(deleted)] || matched[deleted] {
+			continue
+		}
+
+		result.Entries = append(result.Entries, DiffEntry{
+			Type: TombstoneDiff,
+			Path: deleted,
+		})
+	}
+
+	return nil
+}
+
+func childrenByName(leaf *DagLeaf, dag *Dag) (map[string]*DagLeaf, error) {
+	children := map[string]*DagLeaf{}
+
+	for _, link := range leaf.Links {
+		child, exists := dag.Leafs[link]
+		if !exists {
+			return nil, fmt.Errorf("child %s of %s is missing from dag", link, leaf.Hash)
+		}
+
+		children[child.ItemName] = child
+	}
+
+	return children, nil
+}
+
+type moveCandidate struct {
+	entry       int
+	path        string
+	leaf        *DagLeaf
+	fingerprint string
+}
+
+// Pairs removed and added entries whose content is the same, wherever they are and whatever their names.
+// A file can also move into an added directory or out of a removed one, the directory entry is kept
+// and the move is reported for the file
+func detectMoves(result *DagDiff, a *Dag, b *Dag) error {
+	var removed, added, removedDescendants []moveCandidate
+
+	for i, entry := range result.Entries {
+		var err error
+		switch entry.Type {
+		case RemovedDiff:
+			removed, err = collectCandidates(i, entry.Path, entry.OldLeaf, a, removed)
+		case AddedDiff:
+			added, err = collectCandidates(i, entry.Path, entry.Leaf, b, added)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	byFingerprint := map[string][]moveCandidate{}
+	for _, candidate := range removed {
+		if candidate.path == result.Entries[candidate.entry].Path {
+			byFingerprint[candidate.fingerprint] = append(byFingerprint[candidate.fingerprint], candidate)
+		} else {
+			removedDescendants = append(removedDescendants, candidate)
+		}
+	}
+
+	dropped := map[int]bool{}
+	moves := []DiffEntry{}
+
+	move := func(from moveCandidate, to moveCandidate) {
+		moves = append(moves, DiffEntry{
+			Type:    MovedDiff,
+			Path:    to.path,
+			OldPath: from.path,
+			Leaf:    to.leaf,
+			OldLeaf: from.leaf,
+		})
+	}
+
+	// Removed entries moved to an added entry or into an added directory
+	skipBelow := ""
+	for _, candidate := range added {
+		if skipBelow != "" && isBelow(candidate.path, skipBelow) {
+			continue
+		}
+		skipBelow = ""
+
+		matches := byFingerprint[candidate.fingerprint]
+		if len(matches) == 0 {
+			continue
+		}
+		byFingerprint[candidate.fingerprint] = matches[1:]
+
+		move(matches[0], candidate)
+		dropped[matches[0].entry] = true
+		if candidate.path == result.Entries[candidate.entry].Path {
+			dropped[candidate.entry] = true
+		}
+		skipBelow = candidate.path
+	}
+
+	// Added entries moved out of a removed directory
+	byFingerprint = map[string][]moveCandidate{}
+	for _, candidate := range added {
+		if !dropped[candidate.entry] && candidate.path == result.Entries[candidate.entry].Path {
+			byFingerprint[candidate.fingerprint] = append(byFingerprint[candidate.fingerprint], candidate)
+		}
+	}
+
+	skipBelow = ""
+	for _, candidate := range removedDescendants {
+		if dropped[candidate.entry] || (skipBelow != "" && isBelow(candidate.path, skipBelow)) {
+			continue
+		}
+		skipBelow = ""
+
+		matches := byFingerprint[candidate.fingerprint]
+		if len(matches) == 0 {
+			continue
+		}
+		byFingerprint[candidate.fingerprint] = matches[1:]
+
+		move(candidate, matches[0])
+		dropped[matches[0].entry] = true
+		skipBelow = candidate.path
+	}
+
+	entries := []DiffEntry{}
+	for i, entry := range result.Entries {
+		if !dropped[i] {
+			entries = append(entries, entry)
+		}
+	}
+	result.Entries = append(entries, moves...)
+
+	return nil
+}
+
+// Appends the leaf and everything below it, parents before their children
+func collectCandidates(entry int, entryPath string, leaf *DagLeaf, dag *Dag, candidates []moveCandidate) ([]moveCandidate, error) {
+	index := len(candidates)
+	candidates = append(candidates, moveCandidate{
+		entry: entry,
+		path:  entryPath,
+		leaf:  leaf,
+	})
+
+	h := sha256.New()
+	h.Write([]byte(leaf.Type))
+	h.Write(leaf.ContentHash)
+
+	if leaf.Type == DirectoryLeafType {
+		children, err := childrenByName(leaf, dag)
+		if err != nil {
+			return nil, err
+		}
+
+		names := make([]string, 0, len(children))
+		for name := range children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			childIndex := len(candidates)
+
+			candidates, err = collectCandidates(entry, path.Join(entryPath, name), children[name], dag, candidates)
+			if err != nil {
+				return nil, err
+			}
+
+			h.Write([]byte(fmt.Sprintf("%d:%s", len(name), name)))
+			h.Write([]byte(candidates[childIndex].fingerprint))
+		}
+	} else {
+		// Chunk names contain the file name, so only their content is used, in label order
+		err := dag.iterateChildren(leaf, func(child *DagLeaf) error {
+			h.Write(child.ContentHash)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The fingerprint ignores the name of the leaf and every label, so the same file or
+	// directory has the same fingerprint wherever it is placed
+	candidates[index].fingerprint = string(h.Sum(nil))
+
+	return candidates, nil
+}
+
+func isBelow(entryPath string, parent string) bool {
+	return len(entryPath) > len(parent) && entryPath[:len(parent)] == parent && entryPath[len(parent)] == '/'
+}
+
+func (dag *Dag) iterateChildren(leaf *DagLeaf, fn func(child *DagLeaf) error) error {
+	links := make([]string, 0, len(leaf.Links))
+	for _, link := range leaf.Links {
+		links = append(links, link)
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return labelNumber(links[i]) < labelNumber(links[j])
+	})
+
+	for _, link := range links {
+		child, exists := dag.Leafs[link]
+		if !exists {
+			return fmt.Errorf("child %s of %s is missing from dag", link, leaf.Hash)
+		}
+
+		err := fn(child)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func collectNewLeafs(hash string, dag *Dag, known map[string]bool, result map[string]*DagLeaf) error {
+	// A known CID commits to its whole subtree, so none of it needs syncing
+	if known[GetHash(hash)] {
+		return nil
+	}
+
+	leaf, exists := dag.Leafs[hash]
+	if !exists {
+		return fmt.Errorf("leaf %s is missing from dag", hash)
+	}
+
+	result[hash] = leaf
+
+	for _, link := range leaf.Links {
+		err := collectNewLeafs(link, dag, known, result)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
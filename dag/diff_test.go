@@ -0,0 +1,99 @@
+package dag
+
+import (
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	SetChunkSize(4096)
+
+	large := string(make([]byte, 10000))
+
+	_, inputA := createTestInput(t, map[string]string{
+		"same/one.txt":      "one",
+		"same/two.txt":      "two",
+		"changed.txt":       "before",
+		"removed.txt":       "removed",
+		"large.bin":         large,
+		"docs/readme.txt":   "readme",
+		"docs/license.txt":  "license",
+		"archive/notes.txt": "notes",
+		"archive/old.txt":   "old",
+	})
+
+	_, inputB := createTestInput(t, map[string]string{
+		"same/one.txt":          "one",
+		"same/two.txt":          "two",
+		"changed.txt":           "after",
+		"added.txt":             "added",
+		"moved/large.bin":       large,
+		"documents/readme.txt":  "readme",
+		"documents/license.txt": "license",
+		"notes.txt":             "notes",
+	})
+
+	a, err := CreateDag(inputA, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	b, err := CreateDag(inputB, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	diff, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Failed to diff dags: %s", err)
+	}
+
+	expected := map[string]string{
+		"added.txt":       "added",
+		"changed.txt":     "modified",
+		"documents":       "moved from docs",
+		"moved":           "added",
+		"moved/large.bin": "moved from large.bin",
+		"removed.txt":     "removed",
+		"archive":         "removed",
+		"notes.txt":       "moved from archive/notes.txt",
+	}
+
+	// Files moved into a new directory or out of a removed one are reported next to the directory
+	for _, entry := range diff.Entries {
+		description := string(entry.Type)
+		if entry.Type == MovedDiff {
+			description = "moved from " + entry.OldPath
+		}
+
+		if expected[entry.Path] != description {
+			t.Errorf("Unexpected entry %s %s", entry.Path, description)
+		}
+
+		delete(expected, entry.Path)
+	}
+
+	if len(expected) != 0 {
+		t.Fatalf("Missing entries %v", expected)
+	}
+
+	for hash := range diff.NewLeafs {
+		for known := range a.Leafs {
+			if GetHash(known) == GetHash(hash) {
+				t.Fatalf("Leaf %s is in both dags but was reported as new", hash)
+			}
+		}
+	}
+
+	if _, exists := diff.NewLeafs[b.Root]; !exists {
+		t.Fatal("New root is not part of the new leaves")
+	}
+
+	diff, err = Diff(a, a)
+	if err != nil {
+		t.Fatalf("Failed to diff dags: %s", err)
+	}
+
+	if len(diff.Entries) != 0 || len(diff.NewLeafs) != 0 {
+		t.Fatal("Diff of a dag with itself is not empty")
+	}
+}
@@ -0,0 +1,392 @@
+package dag
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Edits copy the leaves map and rebuild only the directories on the edited paths, every other
+// leaf is shared with the original dag. New and rebuilt leaves get labels above the old LatestLabel
+type dagEditor struct {
+	root      string
+	leafs     map[string]*DagLeaf
+	nextLabel int64
+}
+
+func (dag *Dag) newEditor() (*dagEditor, *DagLeaf, error) {
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return nil, nil, fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	if rootLeaf.Type != DirectoryLeafType {
+		return nil, nil, fmt.Errorf("only dags of a directory can be edited")
+	}
+
+	latestLabel, err := strconv.ParseInt(rootLeaf.LatestLabel, 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid latest label %q: %w", rootLeaf.LatestLabel, err)
+	}
+
+	leafs := make(map[string]*DagLeaf, len(dag.Leafs))
+	for hash, leaf := range dag.Leafs {
+		leafs[hash] = leaf
+	}
+
+	editor := &dagEditor{
+		root:      dag.Root,
+		leafs:     leafs,
+		nextLabel: latestLabel + 1,
+	}
+
+	return editor, rootLeaf, nil
+}
+
+// Adds the file, or replaces the file or directory at the path, creating missing parent directories
+func (dag *Dag) PutFile(filePath string, reader io.Reader) (*Dag, error) {
+	dir, name, err := splitDagPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	editor, rootLeaf, err := dag.newEditor()
+	if err != nil {
+		return nil, err
+	}
+
+	rootLinks := copyLinks(rootLeaf.Links)
+
+	err = editor.editDirectory(rootLinks, dir, true, func(links map[string]string) error {
+		if existing := editor.findChild(links, name); existing != nil {
+			delete(links, GetLabel(existing.Hash))
+			editor.removeLeaf(existing)
+		}
+
+		fileLeaf, err := editor.buildFileLeaf(name, data)
+		if err != nil {
+			return err
+		}
+
+		links[GetLabel(fileLeaf.Hash)] = fileLeaf.Hash
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return editor.buildDag(rootLeaf, rootLinks, editor.additionalData(rootLeaf))
+}
+
+func (dag *Dag) Remove(filePath string) (*Dag, error) {
+	dir, name, err := splitDagPath(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	editor, rootLeaf, err := dag.newEditor()
+	if err != nil {
+		return nil, err
+	}
+
+	rootLinks := copyLinks(rootLeaf.Links)
+
+	err = editor.editDirectory(rootLinks, dir, false, func(links map[string]string) error {
+		existing := editor.findChild(links, name)
+		if existing == nil {
+			return fmt.Errorf("%s does not exist in dag", filePath)
+		}
+
+		delete(links, GetLabel(existing.Hash))
+		editor.removeLeaf(existing)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return editor.buildDag(rootLeaf, rootLinks, editor.additionalData(rootLeaf))
+}
+
+// Moves or renames a file or directory, the destination must not exist
+func (dag *Dag) Move(from string, to string) (*Dag, error) {
+	fromDir, fromName, err := splitDagPath(from)
+	if err != nil {
+		return nil, err
+	}
+
+	toDir, toName, err := splitDagPath(to)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanFrom := path.Join(append(fromDir, fromName)...)
+	cleanTo := path.Join(append(toDir, toName)...)
+	if cleanFrom == cleanTo || strings.HasPrefix(cleanTo, cleanFrom+"/") {
+		return nil, fmt.Errorf("cannot move %s to %s", from, to)
+	}
+
+	editor, rootLeaf, err := dag.newEditor()
+	if err != nil {
+		return nil, err
+	}
+
+	rootLinks := copyLinks(rootLeaf.Links)
+
+	var moved *DagLeaf
+	err = editor.editDirectory(rootLinks, fromDir, false, func(links map[string]string) error {
+		moved = editor.findChild(links, fromName)
+		if moved == nil {
+			return fmt.Errorf("%s does not exist in dag", from)
+		}
+
+		delete(links, GetLabel(moved.Hash))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = editor.editDirectory(rootLinks, toDir, true, func(links map[string]string) error {
+		if editor.findChild(links, toName) != nil {
+			return fmt.Errorf("%s already exists in dag", to)
+		}
+
+		// The children of a renamed leaf are kept, only the leaf itself is rebuilt with its new name
+		if moved.ItemName != toName {
+			delete(editor.leafs, moved.Hash)
+
+			renamed, err := editor.rebuildLeaf(moved, toName, copyLinks(moved.Links))
+			if err != nil {
+				return err
+			}
+
+			moved = renamed
+		}
+
+		links[GetLabel(moved.Hash)] = moved.Hash
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return editor.buildDag(rootLeaf, rootLinks, editor.additionalData(rootLeaf))
+}
+
+// Descends from the links of a directory to the directory at components, calls edit with its links
+// and rebuilds every directory on the way back up
+func (e *dagEditor) editDirectory(links map[string]string, components []string, create bool, edit func(links map[string]string) error) error {
+	if len(components) == 0 {
+		return edit(links)
+	}
+
+	child := e.findChild(links, components[0])
+	if child == nil {
+		if !create {
+			return fmt.Errorf("directory %s does not exist in dag", components[0])
+		}
+
+		child = &DagLeaf{
+			ItemName:         components[0],
+			Type:             DirectoryLeafType,
+			Links:            map[string]string{},
+			MerkleHashScheme: MerkleHashScheme,
+		}
+	} else if child.Type != DirectoryLeafType {
+		return fmt.Errorf("%s is not a directory", components[0])
+	}
+
+	childLinks := copyLinks(child.Links)
+
+	err := e.editDirectory(childLinks, components[1:], create, edit)
+	if err != nil {
+		return err
+	}
+
+	newChild, err := e.rebuildLeaf(child, child.ItemName, childLinks)
+	if err != nil {
+		return err
+	}
+
+	if child.Hash != "" {
+		delete(links, GetLabel(child.Hash))
+		delete(e.leafs, child.Hash)
+	}
+
+	links[GetLabel(newChild.Hash)] = newChild.Hash
+
+	return nil
+}
+
+// Builds a copy of the leaf with a new name and links, under a new label
+func (e *dagEditor) rebuildLeaf(leaf *DagLeaf, name string, links map[string]string) (*DagLeaf, error) {
+	builder := CreateDagLeafBuilder(name)
+	builder.SetType(leaf.Type)
+	builder.SetData(leaf.Content)
+	builder.SetMerkleHashScheme(leaf.MerkleHashScheme)
+	builder.SetMetadata(leaf.Metadata)
+	builder.Links = links
+
+	result, err := builder.BuildLeaf(leaf.AdditionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	result.SetLabel(e.label())
+	e.leafs[result.Hash] = result
+
+	return result, nil
+}
+
+// Same layout as processFile
+func (e *dagEditor) buildFileLeaf(name string, data []byte) (*DagLeaf, error) {
+	builder := CreateDagLeafBuilder(name)
+	builder.SetType(FileLeafType)
+
+	fileChunks := chunkFile(data, ChunkSize)
+
+	if len(fileChunks) == 1 {
+		builder.SetData(fileChunks[0])
+	} else {
+		for i, chunk := range fileChunks {
+			chunkBuilder := CreateDagLeafBuilder(path.Join(name, strconv.Itoa(i)))
+
+			chunkBuilder.SetType(ChunkLeafType)
+			chunkBuilder.SetData(chunk)
+
+			chunkLeaf, err := chunkBuilder.BuildLeaf(nil)
+			if err != nil {
+				return nil, err
+			}
+
+			label := e.label()
+			builder.AddLink(label, chunkLeaf.Hash)
+			chunkLeaf.SetLabel(label)
+			e.leafs[chunkLeaf.Hash] = chunkLeaf
+		}
+	}
+
+	result, err := builder.BuildLeaf(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result.SetLabel(e.label())
+	e.leafs[result.Hash] = result
+
+	return result, nil
+}
+
+// Additional data of the edited root. Deletions are only committed by the revision that made them, and
+// an edited revision becomes a revision of the dag it was edited from
+func (e *dagEditor) additionalData(rootLeaf *DagLeaf) map[string]string {
+	if rootLeaf.AdditionalData == nil {
+		return nil
+	}
+
+	additionalData := map[string]string{}
+	for key, value := range rootLeaf.AdditionalData {
+		additionalData[key] = value
+	}
+
+	delete(additionalData, DeletedKey)
+
+	if _, exists := additionalData[PreviousRootKey]; exists {
+		additionalData[PreviousRootKey] = e.root
+	}
+
+	return additionalData
+}
+
+func (e *dagEditor) buildDag(rootLeaf *DagLeaf, rootLinks map[string]string, additionalData map[string]string) (*Dag, error) {
+	delete(e.leafs, rootLeaf.Hash)
+
+	builder := CreateDagLeafBuilder(rootLeaf.ItemName)
+	builder.SetType(rootLeaf.Type)
+	builder.SetMerkleHashScheme(rootLeaf.MerkleHashScheme)
+	builder.SetMetadata(rootLeaf.Metadata)
+	builder.Links = rootLinks
+
+	// Labels of removed leaves are not handed out again, nextLabel starts above the old LatestLabel
+	builder.latestLabel = e.nextLabel - 1
+
+	dagBuilder := &DagBuilder{Leafs: e.leafs}
+
+	newRoot, err := builder.BuildRootLeaf(dagBuilder, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	dagBuilder.AddLeaf(newRoot, nil)
+
+	return dagBuilder.BuildDag(newRoot.Hash), nil
+}
+
+func (e *dagEditor) label() string {
+	label := strconv.FormatInt(e.nextLabel, 10)
+	e.nextLabel++
+	return label
+}
+
+func (e *dagEditor) findChild(links map[string]string, name string) *DagLeaf {
+	for _, link := range links {
+		child, exists := e.leafs[link]
+		if exists && child.ItemName == name {
+			return child
+		}
+	}
+
+	return nil
+}
+
+func (e *dagEditor) removeLeaf(leaf *DagLeaf) {
+	delete(e.leafs, leaf.Hash)
+
+	for _, link := range leaf.Links {
+		if child, exists := e.leafs[link]; exists {
+			e.removeLeaf(child)
+		}
+	}
+}
+
+func copyLinks(links map[string]string) map[string]string {
+	result := make(map[string]string, len(links))
+	for label, link := range links {
+		result[label] = link
+	}
+
+	return result
+}
+
+// Splits a slash separated path relative to the root into its parent directories and its name
+func splitDagPath(filePath string) ([]string, string, error) {
+	components := []string{}
+	for _, component := range strings.Split(strings.Trim(filePath, "/"), "/") {
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			return nil, "", fmt.Errorf("invalid path %s", filePath)
+		}
+
+		components = append(components, component)
+	}
+
+	if len(components) == 0 {
+		return nil, "", fmt.Errorf("invalid path %s", filePath)
+	}
+
+	return components[:len(components)-1], components[len(components)-1], nil
+}
@@ -0,0 +1,175 @@
+package dag
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEdits(t *testing.T) {
+	SetChunkSize(4096)
+
+	tmpDir, input := createTestInput(t, map[string]string{
+		"keep/one.txt":   "one",
+		"keep/two.txt":   "two",
+		"docs/old.txt":   "old",
+		"remove.txt":     "remove",
+		"replace.txt":    "before",
+		"rename/a.txt":   "a",
+		"rename/b/c.txt": "c",
+	})
+
+	original, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	latestLabel, err := strconv.Atoi(original.Leafs[original.Root].LatestLabel)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	edited, err := original.PutFile("replace.txt", strings.NewReader("after"))
+	if err != nil {
+		t.Fatalf("Failed to replace file: %s", err)
+	}
+
+	edited, err = edited.PutFile("new/nested/file.txt", strings.NewReader("new"))
+	if err != nil {
+		t.Fatalf("Failed to add file: %s", err)
+	}
+
+	edited, err = edited.PutFile("large.bin", bytes.NewReader(make([]byte, 10000)))
+	if err != nil {
+		t.Fatalf("Failed to add file: %s", err)
+	}
+
+	edited, err = edited.Remove("remove.txt")
+	if err != nil {
+		t.Fatalf("Failed to remove file: %s", err)
+	}
+
+	edited, err = edited.Move("rename", "docs/renamed")
+	if err != nil {
+		t.Fatalf("Failed to move directory: %s", err)
+	}
+
+	edited, err = edited.Move("docs/old.txt", "docs/new.txt")
+	if err != nil {
+		t.Fatalf("Failed to rename file: %s", err)
+	}
+
+	_, err = edited.Remove("missing.txt")
+	if err == nil {
+		t.Fatal("Removed a file that does not exist")
+	}
+
+	_, err = edited.Move("docs", "docs/inside")
+	if err == nil {
+		t.Fatal("Moved a directory into itself")
+	}
+
+	for _, dag := range []*Dag{original, edited} {
+		err = dag.Verify()
+		if err != nil {
+			t.Fatalf("Dag failed to verify: %s", err)
+		}
+	}
+
+	// Unchanged leaves are shared and new ones are labelled above the old latest label
+	for hash, leaf := range edited.Leafs {
+		if originalLeaf, exists := original.Leafs[hash]; exists {
+			if originalLeaf != leaf {
+				t.Fatalf("Unchanged leaf %s was not reused", hash)
+			}
+		} else if hash != edited.Root && labelNumber(hash) <= latestLabel {
+			t.Fatalf("New leaf %s reuses a label", hash)
+		}
+	}
+
+	for hash := range original.Leafs {
+		if GetLabel(hash) != "" && labelNumber(hash) > latestLabel {
+			t.Fatalf("Original dag was modified")
+		}
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = edited.CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Failed to create directory: %s", err)
+	}
+
+	expected := map[string]string{
+		"keep/one.txt":         "one",
+		"keep/two.txt":         "two",
+		"docs/new.txt":         "old",
+		"replace.txt":          "after",
+		"new/nested/file.txt":  "new",
+		"docs/renamed/a.txt":   "a",
+		"docs/renamed/b/c.txt": "c",
+	}
+
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(output, name))
+		if err != nil {
+			t.Fatalf("Missing file %s: %s", name, err)
+		}
+
+		if string(data) != content {
+			t.Fatalf("File %s has content %q", name, data)
+		}
+	}
+
+	for _, name := range []string{"remove.txt", "rename", "docs/old.txt"} {
+		if _, err := os.Stat(filepath.Join(output, name)); err == nil {
+			t.Fatalf("%s still exists", name)
+		}
+	}
+
+	diff, err := Diff(original, edited)
+	if err != nil {
+		t.Fatalf("Failed to diff dags: %s", err)
+	}
+
+	for _, entry := range diff.Entries {
+		if entry.Path == "docs/renamed" && (entry.Type != MovedDiff || entry.OldPath != "rename") {
+			t.Fatal("Moved directory is not reported as moved")
+		}
+	}
+
+	// Removing the newest leaf does not lower the latest label, so its label is not handed out again
+	added, err := original.PutFile("b.txt", strings.NewReader("b"))
+	if err != nil {
+		t.Fatalf("Failed to add file: %s", err)
+	}
+
+	removed, err := added.Remove("b.txt")
+	if err != nil {
+		t.Fatalf("Failed to remove file: %s", err)
+	}
+
+	addedLabel := added.Leafs[added.Root].LatestLabel
+	if removed.Leafs[removed.Root].LatestLabel != addedLabel {
+		t.Fatalf("Latest label dropped from %s to %s", addedLabel, removed.Leafs[removed.Root].LatestLabel)
+	}
+
+	readded, err := removed.PutFile("c.txt", strings.NewReader("c"))
+	if err != nil {
+		t.Fatalf("Failed to add file: %s", err)
+	}
+
+	issued, err := strconv.Atoi(addedLabel)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for hash := range readded.Leafs {
+		if _, exists := removed.Leafs[hash]; !exists && hash != readded.Root && labelNumber(hash) <= issued {
+			t.Fatalf("New leaf %s reuses a label", hash)
+		}
+	}
+}
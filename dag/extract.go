@@ -0,0 +1,697 @@
+package dag
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type ExtractOptions struct {
+	// Limits on what the extraction writes, 0 means unlimited
+	MaxBytes int64
+	MaxFiles int // Files, directories and symlinks
+
+	// Keeps what an interrupted extraction of the same root already wrote, files are only
+	// kept when their content matches the chunk hashes of their leaves
+	Resume bool
+
+	// path.Match patterns for slash separated paths relative to the extracted leaf. An entry is
+	// selected when it or one of its parent directories matches, directories are only created
+	// on the way to selected entries. Leaves outside of the selected paths may be missing when
+	// Include is set, so it works on partial dags
+	Include []string
+	Exclude []string
+
+	// Writes the leaves without their content and the stats of the extracted files to a
+	// ManifestFileName file in the extracted directory, which lets Status compare the directory
+	// without being given the dag. CreateDag leaves the manifest out
+	WriteManifest bool
+
+	// Recorded metadata comes from the dag, which may not be trusted. Only the user.* and
+	// system.posix_acl_* extended attributes are restored unless AllXattrs is set, which also
+	// restores namespaces like security.* and trusted.*. The recorded owners are only restored
+	// with RestoreOwnership, and the setuid and setgid bits are never restored
+	AllXattrs        bool
+	RestoreOwnership bool
+}
+
+// Writes the dag to a staging path next to path and renames it into place once everything has
+// been written, so path either does not exist or holds the whole dag. Every leaf is verified
+// before its content is written
+func (dag *Dag) Extract(path string, options *ExtractOptions) error {
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	return dag.extract(rootLeaf, nil, path, options)
+}
+
+// Extracts the file, directory or symlink at the slash separated path relative to the root,
+// only the leaves on that path and below it are needed
+func (dag *Dag) ExtractLeaf(leafPath string, dest string, options *ExtractOptions) error {
+	dir, name, err := splitDagPath(leafPath)
+	if err != nil {
+		return err
+	}
+
+	leaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	e := newExtractor("", dag, nil)
+
+	err = e.verify(leaf, nil)
+	if err != nil {
+		return err
+	}
+
+	var parent *DagLeaf
+	for _, component := range append(dir, name) {
+		child := dag.childByName(leaf, component)
+		if child == nil {
+			return fmt.Errorf("%s does not exist in dag", leafPath)
+		}
+
+		err = e.verify(child, leaf)
+		if err != nil {
+			return err
+		}
+
+		parent, leaf = leaf, child
+	}
+
+	return dag.extract(leaf, parent, dest, options)
+}
+
+func (dag *Dag) extract(leaf *DagLeaf, parent *DagLeaf, dest string, options *ExtractOptions) error {
+	if _, err := os.Lstat(dest); !os.IsNotExist(err) {
+		return fmt.Errorf("%s already exists", dest)
+	}
+
+	e := newExtractor(stagingPath(dest, leaf.Hash), dag, options)
+
+	for _, pattern := range append(e.options.Include, e.options.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if !e.options.Resume {
+		err := os.RemoveAll(e.root)
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.options.WriteManifest {
+		if leaf.Hash != dag.Root || leaf.Type != DirectoryLeafType {
+			return fmt.Errorf("manifests can only be written when extracting a directory dag from its root")
+		}
+
+		e.stats = NewStatCache()
+		e.stats.Root = dag.Root
+	}
+
+	err := e.create(leaf, parent, e.root, "")
+	if err != nil {
+		return err
+	}
+
+	err = e.checkSymlinks()
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range e.options.Include {
+		if !e.matched[pattern] {
+			return fmt.Errorf("nothing in the dag matches %q", pattern)
+		}
+	}
+
+	if e.stats != nil {
+		err = writeManifest(e.root, newManifest(dag, e.stats))
+		if err != nil {
+			return err
+		}
+
+		// Writing the manifest changed the modification time of the directory
+		err = leaf.Metadata.restore(e.root, &e.options)
+		if err != nil {
+			return err
+		}
+	}
+
+	return os.Rename(e.root, dest)
+}
+
+func stagingPath(path string, hash string) string {
+	dir, name := filepath.Split(filepath.Clean(path))
+	return filepath.Join(dir, fmt.Sprintf(".%s.%s.partial", name, GetHash(hash)))
+}
+
+// Every name is checked before it is joined to the output path, so a dag from an untrusted
+// source can not write outside of root
+type extractor struct {
+	root     string
+	dag      *Dag
+	options  ExtractOptions
+	bytes    int64
+	files    int
+	matched  map[string]bool
+	stats    *StatCache
+	symlinks []string // Created symlinks, checked again once all of them exist
+}
+
+func newExtractor(root string, dag *Dag, options *ExtractOptions) *extractor {
+	e := &extractor{
+		root:    root,
+		dag:     dag,
+		matched: map[string]bool{},
+	}
+
+	if options != nil {
+		e.options = *options
+	}
+
+	return e
+}
+
+func (e *extractor) create(leaf *DagLeaf, parent *DagLeaf, path string, rel string) error {
+	err := e.verify(leaf, parent)
+	if err != nil {
+		return err
+	}
+
+	e.files++
+	if e.options.MaxFiles > 0 && e.files > e.options.MaxFiles {
+		return fmt.Errorf("extraction exceeds the limit of %d files", e.options.MaxFiles)
+	}
+
+	switch leaf.Type {
+	case DirectoryLeafType:
+		return e.createDirectory(leaf, path, rel)
+	case FileLeafType:
+		return e.createFile(leaf, path, rel)
+	case SymlinkLeafType:
+		return e.createSymlink(leaf, path)
+	}
+
+	return fmt.Errorf("leaf %s has unknown type %q", leaf.Hash, leaf.Type)
+}
+
+func (e *extractor) createDirectory(leaf *DagLeaf, path string, rel string) error {
+	err := os.Mkdir(path, os.ModePerm)
+	if os.IsExist(err) {
+		err = checkExisting(path, true)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	children, err := e.children(leaf, rel)
+	if err != nil {
+		return err
+	}
+
+	// Symlinks are created after everything else in the directory so nothing is written through them
+	symlinks := []*DagLeaf{}
+	names := map[string]bool{}
+	files := e.files
+
+	for _, child := range children {
+		err := ValidateItemName(child.ItemName)
+		if err != nil {
+			return err
+		}
+
+		if names[child.ItemName] {
+			return fmt.Errorf("duplicate name %q in directory %s", child.ItemName, path)
+		}
+		names[child.ItemName] = true
+
+		childRel := child.ItemName
+		if rel != "" {
+			childRel = rel + "/" + child.ItemName
+		}
+
+		if !e.selects(childRel, child.Type == DirectoryLeafType) {
+			continue
+		}
+
+		if child.Type == SymlinkLeafType {
+			symlinks = append(symlinks, child)
+			continue
+		}
+
+		err = e.create(child, leaf, filepath.Join(path, child.ItemName), childRel)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, child := range symlinks {
+		err := e.create(child, leaf, filepath.Join(path, child.ItemName), "")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Directories that were only entered to look for selected entries are removed when none were found
+	if rel != "" && e.files == files && !e.included(rel) {
+		e.files--
+		return os.Remove(path)
+	}
+
+	// Set once the children are written, which would otherwise change the modification time
+	return leaf.Metadata.restore(path, &e.options)
+}
+
+// Children in label order. A missing child is only skipped in a directory that was entered to look
+// for selected entries, every child of a selected directory is needed. An include pattern naming
+// a missing child still fails because nothing matches it
+func (e *extractor) children(leaf *DagLeaf, rel string) ([]*DagLeaf, error) {
+	selected := len(e.options.Include) == 0 || (rel != "" && e.included(rel))
+
+	labels := make([]string, 0, len(leaf.Links))
+	for label := range leaf.Links {
+		labels = append(labels, label)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labelNumber(leaf.Links[labels[i]]) < labelNumber(leaf.Links[labels[j]])
+	})
+
+	children := make([]*DagLeaf, 0, len(labels))
+	for _, label := range labels {
+		child, exists := e.dag.Leafs[leaf.Links[label]]
+		if !exists {
+			if !selected {
+				continue
+			}
+
+			return nil, fmt.Errorf("invalid link: %s", leaf.Links[label])
+		}
+
+		children = append(children, child)
+	}
+
+	return children, nil
+}
+
+// Directories that are not selected themselves are still entered when an include pattern may match below them
+func (e *extractor) selects(rel string, isDir bool) bool {
+	if e.excluded(rel) {
+		return false
+	}
+
+	if e.included(rel) {
+		return true
+	}
+
+	if !isDir {
+		return false
+	}
+
+	depth := strings.Count(rel, "/") + 1
+	for _, pattern := range e.options.Include {
+		patternComponents := strings.Split(pattern, "/")
+		if len(patternComponents) <= depth {
+			continue
+		}
+
+		if matched, _ := path.Match(strings.Join(patternComponents[:depth], "/"), rel); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *extractor) included(rel string) bool {
+	if len(e.options.Include) == 0 {
+		return true
+	}
+
+	result := false
+	for _, pattern := range e.options.Include {
+		if matchesPath(pattern, rel) {
+			e.matched[pattern] = true
+			result = true
+		}
+	}
+
+	return result
+}
+
+func (e *extractor) excluded(rel string) bool {
+	for _, pattern := range e.options.Exclude {
+		if matchesPath(pattern, rel) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches the path or one of its parent directories
+func matchesPath(pattern string, rel string) bool {
+	for {
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+
+		index := strings.LastIndex(rel, "/")
+		if index < 0 {
+			return false
+		}
+
+		rel = rel[:index]
+	}
+}
+
+func (e *extractor) createFile(leaf *DagLeaf, path string, rel string) error {
+	chunks, err := e.fileChunks(leaf)
+	if err != nil {
+		return err
+	}
+
+	err = checkExisting(path, false)
+	if err != nil {
+		return err
+	}
+
+	if !e.options.Resume || !matchesChunks(path, chunks, contentSizes(chunks)) {
+		err = writeChunks(path, chunks)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = leaf.Metadata.restore(path, &e.options)
+	if err != nil {
+		return err
+	}
+
+	if e.stats != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		e.stats.Entries[rel] = StatCacheEntry{
+			Size:    info.Size(),
+			ModTime: info.ModTime().UnixNano(),
+			Inode:   fileInode(info),
+			Hash:    leaf.Hash,
+		}
+	}
+
+	return nil
+}
+
+// Verified chunks of the file in label order, the order they were created in, or the file
+// leaf itself when it holds the content
+func (e *extractor) fileChunks(leaf *DagLeaf) ([]*DagLeaf, error) {
+	size := int64(len(leaf.Content))
+	chunks := []*DagLeaf{}
+
+	err := e.dag.iterateChildren(leaf, func(chunk *DagLeaf) error {
+		err := e.verify(chunk, leaf)
+		if err != nil {
+			return err
+		}
+
+		size += int64(len(chunk.Content))
+		chunks = append(chunks, chunk)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.bytes += size
+	if e.options.MaxBytes > 0 && e.bytes > e.options.MaxBytes {
+		return nil, fmt.Errorf("extraction exceeds the limit of %d bytes", e.options.MaxBytes)
+	}
+
+	if len(chunks) == 0 {
+		return []*DagLeaf{leaf}, nil
+	}
+
+	return chunks, nil
+}
+
+func writeChunks(path string, chunks []*DagLeaf) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		_, err = file.Write(chunk.Content)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return file.Close()
+}
+
+func contentSizes(chunks []*DagLeaf) []int64 {
+	sizes := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		sizes[i] = int64(len(chunk.Content))
+	}
+
+	return sizes
+}
+
+func matchesChunks(path string, chunks []*DagLeaf, sizes []int64) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+
+	defer file.Close()
+
+	var size int64
+	for _, chunkSize := range sizes {
+		size += chunkSize
+	}
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return false
+	}
+
+	for i, chunk := range chunks {
+		// Empty files have no content hash
+		if chunk.ContentHash == nil && sizes[i] == 0 {
+			continue
+		}
+
+		buf := make([]byte, sizes[i])
+
+		_, err := io.ReadFull(file, buf)
+		if err != nil {
+			return false
+		}
+
+		hash := sha256.Sum256(buf)
+		if !bytes.Equal(hash[:], chunk.ContentHash) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Checks the leaf against its CID, its content against the content hash, and that the parent links to it
+func (e *extractor) verify(leaf *DagLeaf, parent *DagLeaf) error {
+	if parent != nil && !parent.HasLink(leaf.Hash) {
+		return fmt.Errorf("parent %s does not contain link to child %s", parent.Hash, leaf.Hash)
+	}
+
+	var err error
+	if leaf.Hash == e.dag.Root {
+		err = leaf.VerifyRootLeaf()
+	} else {
+		err = leaf.VerifyLeaf()
+	}
+
+	if err != nil {
+		return fmt.Errorf("leaf %s failed to verify: %w", leaf.Hash, err)
+	}
+
+	// The children are verified against their links next, so the links must be the committed ones
+	err = leaf.verifyLinks()
+	if err != nil {
+		return err
+	}
+
+	if leaf.Content != nil || leaf.ContentHash != nil {
+		hash := sha256.Sum256(leaf.Content)
+		if !bytes.Equal(hash[:], leaf.ContentHash) {
+			return fmt.Errorf("content of leaf %s does not match its content hash", leaf.Hash)
+		}
+	}
+
+	return nil
+}
+
+func (e *extractor) createSymlink(leaf *DagLeaf, path string) error {
+	target := string(leaf.Content)
+
+	// Only relative targets that stay inside the directory being created are allowed
+	if target == "" || filepath.IsAbs(target) || filepath.VolumeName(target) != "" {
+		return fmt.Errorf("symlink %s has an unsafe target %q", path, target)
+	}
+
+	err := e.resolveInside(filepath.Dir(path), target)
+	if err != nil {
+		return fmt.Errorf("symlink %s points outside of %s: %w", path, e.root, err)
+	}
+
+	if existing, err := os.Readlink(path); err == nil {
+		if e.options.Resume && existing == target {
+			e.symlinks = append(e.symlinks, path)
+			return nil
+		}
+
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	err = os.Symlink(target, path)
+	if err != nil {
+		return err
+	}
+
+	e.symlinks = append(e.symlinks, path)
+
+	return nil
+}
+
+// A symlink created later can turn the target of an earlier one into a chain leading outside of
+// root, so every symlink is resolved again once all of them exist. Escaping symlinks are removed
+func (e *extractor) checkSymlinks() error {
+	for _, path := range e.symlinks {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		err = e.resolveInside(filepath.Dir(path), target)
+		if err != nil {
+			os.Remove(path)
+			return fmt.Errorf("symlink %s points outside of %s: %w", path, e.root, err)
+		}
+	}
+
+	return nil
+}
+
+// Resolves a relative target from dir the way the kernel does, following the symlinks that already
+// exist below root, and fails when the path leaves root. Components that do not exist are taken as is
+func (e *extractor) resolveInside(dir string, target string) error {
+	rel, err := filepath.Rel(e.root, dir)
+	if err != nil {
+		return err
+	}
+
+	resolved := []string{}
+	if rel != "." {
+		resolved = splitPath(rel)
+	}
+
+	pending := splitPath(target)
+	hops := 0
+
+	for len(pending) > 0 {
+		component := pending[0]
+		pending = pending[1:]
+
+		switch component {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return fmt.Errorf("%q leaves the directory", target)
+			}
+
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		resolved = append(resolved, component)
+
+		link, err := os.Readlink(filepath.Join(append([]string{e.root}, resolved...)...))
+		if err != nil {
+			continue
+		}
+
+		hops++
+		if hops > 40 {
+			return fmt.Errorf("too many levels of symlinks in %q", target)
+		}
+
+		if filepath.IsAbs(link) || filepath.VolumeName(link) != "" {
+			return fmt.Errorf("%q passes through the absolute symlink %q", target, link)
+		}
+
+		resolved = resolved[:len(resolved)-1]
+		pending = append(splitPath(link), pending...)
+	}
+
+	return nil
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.ToSlash(path), "/")
+}
+
+// Whatever is already at the path is only reused when it is not a symlink, which could lead outside of the output
+func checkExisting(path string, isDir bool) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to write through the existing symlink %s", path)
+	}
+
+	if info.IsDir() != isDir {
+		return fmt.Errorf("%s already exists with another type", path)
+	}
+
+	return nil
+}
+
+// Item names of leaves written to disk must be a single path component
+func ValidateItemName(name string) error {
+	switch {
+	case name == "", name == ".", name == "..":
+		return fmt.Errorf("invalid item name %q", name)
+	case strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("item name %q contains a separator or NUL", name)
+	case filepath.IsAbs(name), filepath.VolumeName(name) != "":
+		return fmt.Errorf("item name %q is an absolute path", name)
+	}
+
+	return nil
+}
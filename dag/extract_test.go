@@ -0,0 +1,482 @@
+package dag
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeExtraction(t *testing.T) {
+	tmpDir, _ := createTestInput(t, nil)
+
+	// Builds a dag of one directory holding files with the given names, which CreateDag never produces
+	buildDag := func(names ...string) *Dag {
+		dagBuilder := CreateDagBuilder()
+		builder := CreateDagLeafBuilder("root")
+		builder.SetType(DirectoryLeafType)
+
+		for _, name := range names {
+			fileBuilder := CreateDagLeafBuilder(name)
+			fileBuilder.SetType(FileLeafType)
+			fileBuilder.SetData([]byte("content"))
+
+			leaf, err := fileBuilder.BuildLeaf(nil)
+			if err != nil {
+				t.Fatalf("Error: %s", err)
+			}
+
+			label := dagBuilder.GetNextAvailableLabel()
+			builder.AddLink(label, leaf.Hash)
+			leaf.SetLabel(label)
+			dagBuilder.AddLeaf(leaf, nil)
+		}
+
+		root, err := builder.BuildRootLeaf(dagBuilder, nil)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		dagBuilder.AddLeaf(root, nil)
+
+		return dagBuilder.BuildDag(root.Hash)
+	}
+
+	for _, name := range []string{"../escape.txt", "/tmp/absolute.txt", "a/b.txt", "..", "nul\x00.txt", ""} {
+		err := buildDag(name).CreateDirectory(filepath.Join(tmpDir, "output"))
+		if err == nil {
+			t.Fatalf("Extracted a leaf named %q", name)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatal("A leaf was written outside of the output directory")
+	}
+
+	err := buildDag("same.txt", "same.txt").CreateDirectory(filepath.Join(tmpDir, "duplicates"))
+	if err == nil {
+		t.Fatal("Extracted two leaves with the same name")
+	}
+
+	// Existing symlinks in the output are not written through
+	output := filepath.Join(tmpDir, "existing")
+	err = os.Mkdir(output, 0755)
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+
+	err = os.Symlink(filepath.Join(tmpDir, "target.txt"), filepath.Join(output, "file.txt"))
+	if err != nil {
+		t.Fatalf("Could not create symlink: %s", err)
+	}
+
+	err = buildDag("file.txt").CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(tmpDir, "target.txt")); !os.IsNotExist(err) {
+		t.Fatal("Wrote through an existing symlink")
+	}
+
+	if info, err := os.Lstat(filepath.Join(output, "file.txt")); err != nil || !info.Mode().IsRegular() {
+		t.Fatal("Existing symlink was not replaced")
+	}
+
+	// Limits
+	dag := buildDag("one.txt", "two.txt", "three.txt")
+
+	err = dag.Extract(filepath.Join(tmpDir, "files"), &ExtractOptions{MaxFiles: 3})
+	if err == nil {
+		t.Fatal("Extraction exceeded the file limit")
+	}
+
+	err = dag.Extract(filepath.Join(tmpDir, "bytes"), &ExtractOptions{MaxBytes: 20})
+	if err == nil {
+		t.Fatal("Extraction exceeded the byte limit")
+	}
+
+	err = dag.Extract(filepath.Join(tmpDir, "limited"), &ExtractOptions{MaxFiles: 4, MaxBytes: 21})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// Chains of symlinks whose targets each stay inside lexically, but which lead outside together.
+	// In the second case the symlink completing the chain is created after the one using it
+	SetSymlinkHandling(PreserveSymlinks)
+	defer SetSymlinkHandling(FollowSymlinks)
+
+	for i, links := range []map[string]string{
+		{"d/s": "..", "x": "d/s/.."},
+		{"d/s": "..", "a/x": "../d/s/.."},
+	} {
+		input := filepath.Join(tmpDir, fmt.Sprintf("chain%d", i))
+		for name, target := range links {
+			err := os.MkdirAll(filepath.Join(input, filepath.Dir(name)), 0755)
+			if err != nil {
+				t.Fatalf("Could not create directory: %s", err)
+			}
+
+			err = os.Symlink(target, filepath.Join(input, name))
+			if err != nil {
+				t.Fatalf("Could not create symlink: %s", err)
+			}
+		}
+
+		chained, err := CreateDag(input, false)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		output := filepath.Join(tmpDir, fmt.Sprintf("chain%d-out", i))
+		err = chained.Extract(output, nil)
+		if err == nil {
+			t.Fatalf("Extracted a chain of symlinks leading outside of the output directory")
+		}
+
+		err = chained.CreateDirectory(filepath.Join(tmpDir, fmt.Sprintf("chain%d-created", i)))
+		if err == nil {
+			t.Fatalf("Created a chain of symlinks leading outside of the output directory")
+		}
+
+		if _, err := os.Lstat(output); !os.IsNotExist(err) {
+			t.Fatal("Failed extraction left the output in place")
+		}
+	}
+}
+
+func TestAtomicExtraction(t *testing.T) {
+	SetChunkSize(8)
+	defer SetChunkSize(4096)
+
+	files := map[string]string{
+		"a.txt":     "a file split into several chunks",
+		"b.txt":     "small",
+		"sub/c.txt": "another file split into chunks",
+	}
+
+	tmpDir, input := createTestInput(t, files)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	checkOutput := func(output string) {
+		for name, content := range files {
+			data, err := ioutil.ReadFile(filepath.Join(output, name))
+			if err != nil {
+				t.Fatalf("Error: %s", err)
+			}
+
+			if string(data) != content {
+				t.Fatalf("%s was extracted as %q", name, data)
+			}
+		}
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.Extract(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	checkOutput(output)
+
+	if _, err := os.Stat(stagingPath(output, dag.Root)); !os.IsNotExist(err) {
+		t.Fatal("Staging directory was left behind")
+	}
+
+	if dag.Extract(output, nil) == nil {
+		t.Fatal("Extracted over an existing path")
+	}
+
+	// Tampered chunks are never written and the output does not appear
+	tampered := &Dag{Root: dag.Root, Leafs: map[string]*DagLeaf{}}
+	for hash, leaf := range dag.Leafs {
+		tampered.Leafs[hash] = leaf
+		if leaf.Type == ChunkLeafType && tampered.Leafs[hash].Content[0] == 'a' {
+			clone := leaf.Clone()
+			clone.Content = []byte("tampered")
+			tampered.Leafs[hash] = clone
+		}
+	}
+
+	err = tampered.Extract(filepath.Join(tmpDir, "tampered"), nil)
+	if err == nil {
+		t.Fatal("Extracted a tampered chunk")
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "tampered")); !os.IsNotExist(err) {
+		t.Fatal("Failed extraction left output behind")
+	}
+
+	// A valid chunk of another file swapped in under a verified file leaf is detected by its links
+	fileLeaf, err := dag.leafAtPath("a.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	otherLeaf, err := dag.leafAtPath("sub/c.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	swapped := &Dag{Root: dag.Root, Leafs: map[string]*DagLeaf{}}
+	for hash, leaf := range dag.Leafs {
+		swapped.Leafs[hash] = leaf
+	}
+
+	var label, otherChunk string
+	for label = range fileLeaf.Links {
+		break
+	}
+	for _, otherChunk = range otherLeaf.Links {
+		break
+	}
+
+	swappedChunk := dag.Leafs[otherChunk].Clone()
+	swappedChunk.Hash = label + ":" + GetHash(otherChunk)
+	swapped.Leafs[swappedChunk.Hash] = swappedChunk
+
+	swappedFile := fileLeaf.Clone()
+	swappedFile.Links = copyLinks(fileLeaf.Links)
+	swappedFile.Links[label] = swappedChunk.Hash
+	swapped.Leafs[fileLeaf.Hash] = swappedFile
+
+	err = swapped.Extract(filepath.Join(tmpDir, "swapped"), nil)
+	if err == nil {
+		t.Fatal("Extracted a file with a swapped chunk")
+	}
+
+	// An interrupted extraction is resumed from what it already wrote
+	resumed := filepath.Join(tmpDir, "resumed")
+	staging := stagingPath(resumed, dag.Root)
+
+	err = dag.Extract(resumed, &ExtractOptions{MaxFiles: 3})
+	if err == nil {
+		t.Fatal("Extraction was not interrupted")
+	}
+
+	written, err := filepath.Glob(filepath.Join(staging, "*.txt"))
+	if err != nil || len(written) != 2 {
+		t.Fatalf("Expected 2 files in the staging directory, got %d", len(written))
+	}
+
+	oldTime := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = os.Chtimes(written[0], oldTime, oldTime)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = ioutil.WriteFile(written[1], []byte("half writ"), 0644)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = dag.Extract(resumed, &ExtractOptions{Resume: true})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	checkOutput(resumed)
+
+	info, err := os.Stat(filepath.Join(resumed, filepath.Base(written[0])))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if !info.ModTime().Equal(oldTime) {
+		t.Fatal("A file that was already written was written again")
+	}
+}
+
+func TestCreateDirectoryIntoExisting(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{
+		"a.txt":     "new",
+		"sub/b.txt": "b",
+	})
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	writeTestFile(t, filepath.Join(output, "a.txt"), "old")
+	writeTestFile(t, filepath.Join(output, "keep.txt"), "keep")
+	writeTestFile(t, filepath.Join(output, "sub", "other.txt"), "other")
+
+	if dag.Extract(output, nil) == nil {
+		t.Fatal("Extracted into an existing directory")
+	}
+
+	err = dag.CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for name, content := range map[string]string{
+		"a.txt":         "new",
+		"keep.txt":      "keep",
+		"sub/b.txt":     "b",
+		"sub/other.txt": "other",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(output, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		if string(data) != content {
+			t.Fatalf("%s holds %q instead of %q", name, data, content)
+		}
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			t.Fatalf("Temporary directory %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestSelectiveExtraction(t *testing.T) {
+	files := map[string]string{}
+	for _, name := range []string{"README.md", "docs/a.txt", "docs/b.md", "src/main.go", "src/lib/util.go"} {
+		files[name] = name
+	}
+
+	tmpDir, input := createTestInput(t, files)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// Lists the slash separated paths of every file below dir
+	listFiles := func(dir string) []string {
+		files := []string{}
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			if rel != "." {
+				files = append(files, filepath.ToSlash(rel))
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		return files
+	}
+
+	for i, test := range []struct {
+		options  ExtractOptions
+		expected string
+	}{
+		{ExtractOptions{Include: []string{"docs"}}, "docs docs/a.txt docs/b.md"},
+		{ExtractOptions{Include: []string{"src/*/*.go"}}, "src src/lib src/lib/util.go"},
+		{ExtractOptions{Include: []string{"*.md", "docs/*.md"}}, "README.md docs docs/b.md"},
+		{ExtractOptions{Exclude: []string{"src", "*.md", "*/*.md"}}, "docs docs/a.txt"},
+		{ExtractOptions{Include: []string{"src"}, Exclude: []string{"src/lib"}}, "src src/main.go"},
+	} {
+		output := filepath.Join(tmpDir, fmt.Sprintf("output%d", i))
+
+		err = dag.Extract(output, &test.options)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		files := strings.Join(listFiles(output), " ")
+		if files != test.expected {
+			t.Fatalf("Extracted %q instead of %q", files, test.expected)
+		}
+	}
+
+	err = dag.Extract(filepath.Join(tmpDir, "nothing"), &ExtractOptions{Include: []string{"missing/*"}})
+	if err == nil {
+		t.Fatal("Extraction succeeded without matching the include pattern")
+	}
+
+	// Only the leaves on the selected paths are needed
+	removed, err := dag.deletedLeafs(&MetaData{Deleted: []string{"src", "README.md"}})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	partial := dag.withoutLeafs(removed)
+
+	err = partial.Extract(filepath.Join(tmpDir, "partial"), &ExtractOptions{Include: []string{"docs/a.txt"}})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "partial", "docs", "a.txt"))
+	if err != nil || string(data) != "docs/a.txt" {
+		t.Fatal("File was not extracted from the partial dag")
+	}
+
+	err = partial.ExtractLeaf("docs", filepath.Join(tmpDir, "leaf"), nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if files := strings.Join(listFiles(filepath.Join(tmpDir, "leaf")), " "); files != "a.txt b.md" {
+		t.Fatalf("Extracted %q from the leaf", files)
+	}
+
+	err = dag.ExtractLeaf("src/lib/util.go", filepath.Join(tmpDir, "util.go"), nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	data, err = ioutil.ReadFile(filepath.Join(tmpDir, "util.go"))
+	if err != nil || string(data) != "src/lib/util.go" {
+		t.Fatal("Single file was not extracted")
+	}
+
+	if partial.ExtractLeaf("src/main.go", filepath.Join(tmpDir, "main.go"), nil) == nil {
+		t.Fatal("Extracted a leaf missing from the partial dag")
+	}
+
+	// A selected file whose leaf is missing while its directory still links to it
+	main, err := dag.leafAtPath("src/main.go")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	missing := &Dag{Root: dag.Root, Leafs: map[string]*DagLeaf{}}
+	for hash, leaf := range dag.Leafs {
+		if hash != main.Hash {
+			missing.Leafs[hash] = leaf
+		}
+	}
+
+	for i, include := range []string{"src", "src/main.go", "src/*.go"} {
+		err = missing.Extract(filepath.Join(tmpDir, fmt.Sprintf("missing%d", i)), &ExtractOptions{Include: []string{include}})
+		if err == nil {
+			t.Fatalf("Extracted %s without the leaf of src/main.go", include)
+		}
+	}
+
+	err = missing.Extract(filepath.Join(tmpDir, "unselected"), &ExtractOptions{Include: []string{"docs", "src/lib"}})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+}
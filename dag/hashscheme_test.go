@@ -0,0 +1,58 @@
+package dag
+
+import (
+	"testing"
+
+	"github.com/HORNET-Storage/scionic-merkletree/merkletree"
+)
+
+func TestMerkleHashScheme(t *testing.T) {
+	_, input := createTestInput(t, nil)
+	GenerateDummyDirectory(input, 6, 4)
+
+	SetChunkSize(4096)
+
+	legacyDag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	SetMerkleHashScheme(merkletree.HashSchemeRFC6962)
+	defer SetMerkleHashScheme(merkletree.HashSchemeLegacy)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if dag.Root == legacyDag.Root {
+		t.Fatal("Dag built with the RFC 6962 scheme has the same root as the legacy dag")
+	}
+
+	err = dag.Verify()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, leaf := range dag.Leafs {
+		if leaf.MerkleHashScheme != merkletree.HashSchemeRFC6962 {
+			t.Fatalf("Leaf %s does not record the hash scheme", leaf.Hash)
+		}
+
+		for label := range leaf.Links {
+			branch, err := leaf.GetBranch(label)
+			if err != nil {
+				t.Fatalf("Failed to retrieve branch: %s", err)
+			}
+
+			if branch == nil {
+				continue
+			}
+
+			err = leaf.VerifyBranch(branch)
+			if err != nil {
+				t.Fatalf("Failed to verify branch: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package dag
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Returned by a History callback to stop walking without an error
+var ErrStopHistory = errors.New("stop history")
+
+// Creates a dag whose root leaf commits the previous root CID in its hashed additional data
+func CreateDagRevision(path string, prevRoot string) (*Dag, error) {
+	if HasLabel(prevRoot) {
+		return nil, fmt.Errorf("previous root %s is not a root", prevRoot)
+	}
+
+	_, err := cid.Decode(prevRoot)
+	if err != nil {
+		return nil, fmt.Errorf("invalid previous root: %w", err)
+	}
+
+	additionalData := map[string]string{
+		PreviousRootKey: prevRoot,
+	}
+
+	dag, err := createDag(path, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	return dag, nil
+}
+
+func (dag *Dag) PreviousRoot() string {
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return ""
+	}
+
+	return rootLeaf.AdditionalData[PreviousRootKey]
+}
+
+// Walks from root back through every previous revision in the store, newest first. Each dag is
+// verified before it is passed to fn so the previous root it points to is covered by its root CID
+func History(store DagStore, root string, fn func(dag *Dag) error) error {
+	visited := map[string]bool{}
+
+	for root != "" {
+		if visited[root] {
+			return fmt.Errorf("revision chain loops back to %s", root)
+		}
+		visited[root] = true
+
+		dag, err := store.GetDag(root)
+		if err != nil {
+			return err
+		}
+
+		if dag.Root != root {
+			return fmt.Errorf("store returned dag %s for root %s", dag.Root, root)
+		}
+
+		err = dag.Verify()
+		if err != nil {
+			return fmt.Errorf("revision %s failed to verify: %w", root, err)
+		}
+
+		err = fn(dag)
+		if errors.Is(err, ErrStopHistory) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		root = dag.PreviousRoot()
+	}
+
+	return nil
+}
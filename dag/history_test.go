@@ -0,0 +1,91 @@
+package dag
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	_, input := createTestInput(t, nil)
+
+	store := NewMemoryDagStore()
+	roots := []string{}
+
+	for i := 0; i < 3; i++ {
+		writeTestFile(t, filepath.Join(input, fmt.Sprintf("file%d.txt", i)), fmt.Sprintf("content %d", i))
+
+		var dag *Dag
+		var err error
+		if i == 0 {
+			dag, err = CreateDag(input, false)
+		} else {
+			dag, err = CreateDagRevision(input, roots[i-1])
+		}
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		err = store.PutDag(dag)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		roots = append(roots, dag.Root)
+	}
+
+	walked := []string{}
+	err := History(store, roots[2], func(dag *Dag) error {
+		walked = append(walked, dag.Root)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk history: %s", err)
+	}
+
+	if len(walked) != 3 || walked[0] != roots[2] || walked[1] != roots[1] || walked[2] != roots[0] {
+		t.Fatalf("Unexpected history %v", walked)
+	}
+
+	walked = []string{}
+	err = History(store, roots[2], func(dag *Dag) error {
+		walked = append(walked, dag.Root)
+		return ErrStopHistory
+	})
+	if err != nil || len(walked) != 1 {
+		t.Fatal("History did not stop when asked to")
+	}
+
+	// A revision whose previous root was swapped no longer matches its root CID
+	latest, err := store.GetDag(roots[2])
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	latest.Leafs[latest.Root].AdditionalData[PreviousRootKey] = roots[0]
+	err = History(store, roots[2], func(dag *Dag) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("History accepted a tampered previous root")
+	}
+
+	_, err = CreateDagRevision(input, "not a cid")
+	if err == nil {
+		t.Fatal("Created a revision of an invalid root")
+	}
+
+	missing := NewMemoryDagStore()
+	err = missing.PutDag(latest)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	latest.Leafs[latest.Root].AdditionalData[PreviousRootKey] = roots[1]
+	err = History(missing, roots[2], func(dag *Dag) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("History ignored a missing revision")
+	}
+}
@@ -1,11 +1,10 @@
 package dag
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,8 +22,9 @@ import (
 
 func CreateDagLeafBuilder(name string) *DagLeafBuilder {
 	builder := &DagLeafBuilder{
-		ItemName: name,
-		Links:    map[string]string{},
+		ItemName:         name,
+		Links:            map[string]string{},
+		MerkleHashScheme: MerkleHashScheme,
 	}
 
 	return builder
@@ -38,6 +38,14 @@ func (b *DagLeafBuilder) SetData(data []byte) {
 	b.Data = data
 }
 
+func (b *DagLeafBuilder) SetMerkleHashScheme(scheme merkletree.TypeHashScheme) {
+	b.MerkleHashScheme = scheme
+}
+
+func (b *DagLeafBuilder) SetMetadata(metadata *FileMetadata) {
+	b.Metadata = metadata
+}
+
 func (b *DagLeafBuilder) AddLink(label string, hash string) {
 	b.Links[label] = label + ":" + hash
 }
@@ -88,12 +96,7 @@ func (b *DagLeafBuilder) BuildLeaf(additionalData map[string]string) (*DagLeaf,
 	merkleRoot := []byte{}
 
 	if len(b.Links) > 1 {
-		builder := merkle_tree.CreateTree()
-		for _, link := range b.Links {
-			builder.AddLeaf(GetLabel(link), link)
-		}
-
-		merkleTree, _, err := builder.Build()
+		merkleTree, err := buildClassicTree(b.Links, &merkletree.Config{HashScheme: b.MerkleHashScheme})
 		if err != nil {
 			return nil, err
 		}
@@ -110,6 +113,8 @@ func (b *DagLeafBuilder) BuildLeaf(additionalData map[string]string) (*DagLeaf,
 		CurrentLinkCount int
 		ContentHash      []byte
 		AdditionalData   []keyValue
+		MerkleHashScheme merkletree.TypeHashScheme `cbor:",omitempty"`
+		Metadata         *FileMetadata             `cbor:",omitempty"`
 	}{
 		ItemName:         b.ItemName,
 		Type:             b.LeafType,
@@ -117,9 +122,13 @@ func (b *DagLeafBuilder) BuildLeaf(additionalData map[string]string) (*DagLeaf,
 		CurrentLinkCount: len(b.Links),
 		ContentHash:      nil,
 		AdditionalData:   sortMapForVerification(additionalData),
+		MerkleHashScheme: b.MerkleHashScheme,
+		Metadata:         b.Metadata,
 	}
 
-	if b.Data != nil {
+	if b.contentHash != nil {
+		leafData.ContentHash = b.contentHash
+	} else if b.Data != nil {
 		hash := sha256.Sum256(b.Data)
 		leafData.ContentHash = hash[:]
 	}
@@ -151,6 +160,8 @@ func (b *DagLeafBuilder) BuildLeaf(additionalData map[string]string) (*DagLeaf,
 		ContentHash:       leafData.ContentHash,
 		Links:             b.Links,
 		AdditionalData:    additionalData,
+		MerkleHashScheme:  b.MerkleHashScheme,
+		Metadata:          b.Metadata,
 	}
 
 	return result, nil
@@ -165,12 +176,7 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 	merkleRoot := []byte{}
 
 	if len(b.Links) > 1 {
-		builder := merkle_tree.CreateTree()
-		for _, link := range b.Links {
-			builder.AddLeaf(GetLabel(link), link)
-		}
-
-		merkleTree, _, err := builder.Build()
+		merkleTree, err := buildClassicTree(b.Links, &merkletree.Config{HashScheme: b.MerkleHashScheme})
 		if err != nil {
 			return nil, err
 		}
@@ -179,6 +185,9 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 	}
 
 	latestLabel := dag.GetLatestLabel()
+	if number, err := strconv.ParseInt(latestLabel, 10, 64); err == nil && number < b.latestLabel {
+		latestLabel = strconv.FormatInt(b.latestLabel, 10)
+	}
 
 	additionalData = sortMapByKeys(additionalData)
 
@@ -191,6 +200,8 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 		LeafCount        int
 		ContentHash      []byte
 		AdditionalData   []keyValue
+		MerkleHashScheme merkletree.TypeHashScheme `cbor:",omitempty"`
+		Metadata         *FileMetadata             `cbor:",omitempty"`
 	}{
 		ItemName:         b.ItemName,
 		Type:             b.LeafType,
@@ -200,9 +211,13 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 		LeafCount:        len(dag.Leafs),
 		ContentHash:      nil,
 		AdditionalData:   sortMapForVerification(additionalData),
+		MerkleHashScheme: b.MerkleHashScheme,
+		Metadata:         b.Metadata,
 	}
 
-	if b.Data != nil {
+	if b.contentHash != nil {
+		leafData.ContentHash = b.contentHash
+	} else if b.Data != nil {
 		hash := sha256.Sum256(b.Data)
 		leafData.ContentHash = hash[:]
 	}
@@ -236,6 +251,8 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 		ContentHash:       leafData.ContentHash,
 		Links:             b.Links,
 		AdditionalData:    additionalData,
+		MerkleHashScheme:  b.MerkleHashScheme,
+		Metadata:          b.Metadata,
 	}
 
 	return result, nil
@@ -243,13 +260,7 @@ func (b *DagLeafBuilder) BuildRootLeaf(dag *DagBuilder, additionalData map[strin
 
 func (leaf *DagLeaf) GetBranch(key string) (*ClassicTreeBranch, error) {
 	if len(leaf.Links) > 1 {
-		t := merkle_tree.CreateTree()
-
-		for k, v := range leaf.Links {
-			t.AddLeaf(k, v)
-		}
-
-		merkleTree, _, err := t.Build()
+		merkleTree, err := buildClassicTree(leaf.Links, leaf.classicTreeConfig())
 		if err != nil {
 			log.Println("Failed to build merkle tree")
 			return nil, err
@@ -276,7 +287,125 @@ func (leaf *DagLeaf) GetBranch(key string) (*ClassicTreeBranch, error) {
 func (leaf *DagLeaf) VerifyBranch(branch *ClassicTreeBranch) error {
 	block := merkle_tree.CreateLeaf(branch.Leaf)
 
-	err := merkletree.Verify(block, branch.Proof, leaf.ClassicMerkleRoot, nil)
+	err := merkletree.Verify(block, branch.Proof, leaf.ClassicMerkleRoot, leaf.classicTreeConfig())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Proves the links at positions [start, end) of the classic merkle tree. Positions follow the tree,
+// which sorts labels as strings ("10" comes before "2"), so a span of positions is generally not a
+// span of label values
+func (leaf *DagLeaf) GetIndexRangeBranch(start int, end int) (*ClassicTreeRangeBranch, error) {
+	if len(leaf.Links) > 1 {
+		merkleTree, err := buildClassicTree(leaf.Links, leaf.classicTreeConfig())
+		if err != nil {
+			log.Println("Failed to build merkle tree")
+			return nil, err
+		}
+
+		proof, err := merkleTree.RangeProof(start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		leaves := make([]string, 0, end-start)
+		for _, key := range merkleTree.Keys[start:end] {
+			leaves = append(leaves, leaf.Links[key])
+		}
+
+		branch := &ClassicTreeRangeBranch{
+			Leaves: leaves,
+			Proof:  proof,
+		}
+
+		return branch, nil
+	} else {
+		return nil, nil
+	}
+}
+
+// Proves the links labelled first to last, inclusive. Every label in the span must be present and
+// the labels must sit next to each other in the tree. Labels of different lengths interleave when
+// sorted as strings ("5" sorts between "49" and "50"), so such spans are rejected
+func (leaf *DagLeaf) GetLabelRangeBranch(first int, last int) (*ClassicTreeRangeBranch, error) {
+	if first < 1 || last < first {
+		return nil, fmt.Errorf("invalid label span %d-%d", first, last)
+	}
+
+	keys := make([]string, 0, len(leaf.Links))
+	for key := range leaf.Links {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	positions := map[string]int{}
+	for i, key := range keys {
+		positions[key] = i
+	}
+
+	start := -1
+	end := -1
+	for label := first; label <= last; label++ {
+		position, exists := positions[strconv.Itoa(label)]
+		if !exists {
+			return nil, fmt.Errorf("leaf has no link labelled %d", label)
+		}
+
+		if start < 0 || position < start {
+			start = position
+		}
+
+		if position+1 > end {
+			end = position + 1
+		}
+	}
+
+	if end-start != last-first+1 {
+		return nil, fmt.Errorf("labels %d-%d are not contiguous in the classic merkle tree", first, last)
+	}
+
+	return leaf.GetIndexRangeBranch(start, end)
+}
+
+// Checks the range branch and that it holds exactly the links labelled first to last, so no child
+// in the span was withheld
+func (leaf *DagLeaf) VerifyLabelRangeBranch(branch *ClassicTreeRangeBranch, first int, last int) error {
+	if branch == nil || len(branch.Leaves) != last-first+1 {
+		return fmt.Errorf("range branch does not hold the links labelled %d-%d", first, last)
+	}
+
+	seen := map[int]bool{}
+	for _, link := range branch.Leaves {
+		label, err := strconv.Atoi(GetLabel(link))
+		if err != nil || label < first || label > last || seen[label] {
+			return fmt.Errorf("range branch holds unexpected link %s", link)
+		}
+
+		seen[label] = true
+	}
+
+	return leaf.VerifyRangeBranch(branch)
+}
+
+func (leaf *DagLeaf) VerifyRangeBranch(branch *ClassicTreeRangeBranch) error {
+	if branch.Proof == nil {
+		return merkletree.ErrProofIsNil
+	}
+
+	// The link count is part of the leaf hash so a peer can't shrink the tree to hide children
+	if branch.Proof.NumLeaves != leaf.CurrentLinkCount {
+		return fmt.Errorf("range proof covers %d links but leaf has %d", branch.Proof.NumLeaves, leaf.CurrentLinkCount)
+	}
+
+	blocks := make([]merkletree.DataBlock, 0, len(branch.Leaves))
+	for _, link := range branch.Leaves {
+		blocks = append(blocks, merkle_tree.CreateLeaf(link))
+	}
+
+	err := merkletree.VerifyRange(blocks, branch.Proof, leaf.ClassicMerkleRoot, leaf.classicTreeConfig())
 	if err != nil {
 		return err
 	}
@@ -294,6 +423,8 @@ func (leaf *DagLeaf) VerifyLeaf() error {
 		CurrentLinkCount int
 		ContentHash      []byte
 		AdditionalData   []keyValue
+		MerkleHashScheme merkletree.TypeHashScheme `cbor:",omitempty"`
+		Metadata         *FileMetadata             `cbor:",omitempty"`
 	}{
 		ItemName:         leaf.ItemName,
 		Type:             leaf.Type,
@@ -301,6 +432,8 @@ func (leaf *DagLeaf) VerifyLeaf() error {
 		CurrentLinkCount: leaf.CurrentLinkCount,
 		ContentHash:      leaf.ContentHash,
 		AdditionalData:   sortMapForVerification(additionalData),
+		MerkleHashScheme: leaf.MerkleHashScheme,
+		Metadata:         leaf.Metadata,
 	}
 
 	serializedLeafData, err := cbor.Marshal(leafData)
@@ -352,6 +485,31 @@ func (leaf *DagLeaf) VerifyLeaf() error {
 	return nil
 }
 
+// Recomputes the classic merkle root from the links, so a child can not be swapped for another valid
+// leaf under a verified parent. A single link is not committed to by its parent and can not be checked.
+// Directories of partial dags only hold the links of the children they contain, their root can not be
+// recomputed so only the number of links is checked
+func (leaf *DagLeaf) verifyLinks() error {
+	if len(leaf.Links) > leaf.CurrentLinkCount || (len(leaf.Links) < leaf.CurrentLinkCount && leaf.Type != DirectoryLeafType) {
+		return fmt.Errorf("leaf %s has %d links but commits to %d", leaf.Hash, len(leaf.Links), leaf.CurrentLinkCount)
+	}
+
+	if len(leaf.Links) <= 1 || len(leaf.Links) < leaf.CurrentLinkCount {
+		return nil
+	}
+
+	merkleTree, err := buildClassicTree(leaf.Links, leaf.classicTreeConfig())
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(merkleTree.Root, leaf.ClassicMerkleRoot) {
+		return fmt.Errorf("links of leaf %s do not match its classic merkle root", leaf.Hash)
+	}
+
+	return nil
+}
+
 func (leaf *DagLeaf) VerifyRootLeaf() error {
 	additionalData := sortMapByKeys(leaf.AdditionalData)
 
@@ -364,6 +522,8 @@ func (leaf *DagLeaf) VerifyRootLeaf() error {
 		LeafCount        int
 		ContentHash      []byte
 		AdditionalData   []keyValue
+		MerkleHashScheme merkletree.TypeHashScheme `cbor:",omitempty"`
+		Metadata         *FileMetadata             `cbor:",omitempty"`
 	}{
 		ItemName:         leaf.ItemName,
 		Type:             leaf.Type,
@@ -373,6 +533,8 @@ func (leaf *DagLeaf) VerifyRootLeaf() error {
 		LeafCount:        leaf.LeafCount,
 		ContentHash:      leaf.ContentHash,
 		AdditionalData:   sortMapForVerification(additionalData),
+		MerkleHashScheme: leaf.MerkleHashScheme,
+		Metadata:         leaf.Metadata,
 	}
 
 	serializedLeafData, err := cbor.Marshal(leafData)
@@ -425,46 +587,14 @@ func (leaf *DagLeaf) VerifyRootLeaf() error {
 }
 
 func (leaf *DagLeaf) CreateDirectoryLeaf(path string, dag *Dag) error {
-	switch leaf.Type {
-	case DirectoryLeafType:
-		_ = os.Mkdir(path, os.ModePerm)
-
-		for _, link := range leaf.Links {
-			childLeaf := dag.Leafs[link]
-			if childLeaf == nil {
-				return fmt.Errorf("invalid link: %s", link)
-			}
+	e := newExtractor(path, dag, nil)
 
-			childPath := filepath.Join(path, childLeaf.ItemName)
-			err := childLeaf.CreateDirectoryLeaf(childPath, dag)
-			if err != nil {
-				return err
-			}
-		}
-
-	case FileLeafType:
-		var content []byte
-
-		if len(leaf.Links) > 0 {
-			for _, link := range leaf.Links {
-				childLeaf := dag.Leafs[link]
-				if childLeaf == nil {
-					return fmt.Errorf("invalid link: %s", link)
-				}
-
-				content = append(content, childLeaf.Content...)
-			}
-		} else {
-			content = leaf.Content
-		}
-
-		err := os.WriteFile(path, content, os.ModePerm)
-		if err != nil {
-			return err
-		}
+	err := e.create(leaf, nil, path, "")
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return e.checkSymlinks()
 }
 
 func (leaf *DagLeaf) HasLink(hash string) bool {
@@ -518,6 +648,40 @@ func (leaf *DagLeaf) Clone() *DagLeaf {
 		LeafCount:         leaf.LeafCount,
 		Links:             leaf.Links,
 		AdditionalData:    leaf.AdditionalData,
+		MerkleHashScheme:  leaf.MerkleHashScheme,
+		Metadata:          leaf.Metadata,
+	}
+}
+
+// The classic merkle tree orders links by their label as a string, the order the keys of the links
+// map have always been sorted in. The map has no order, so only the labels are sorted and the links
+// are streamed into the tree in that order without copying them into another map or slice
+func buildClassicTree(links map[string]string, config *merkletree.Config) (*merkletree.MerkleTree, error) {
+	labels := make([]string, 0, len(links))
+	for label := range links {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	merkleTree, err := merkletree.NewFromIterator(config, func(yield func(merkletree.DataBlock) bool) {
+		for _, label := range labels {
+			if !yield(merkle_tree.CreateLeaf(links[label])) {
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	merkleTree.Keys = labels
+
+	return merkleTree, nil
+}
+
+func (leaf *DagLeaf) classicTreeConfig() *merkletree.Config {
+	return &merkletree.Config{
+		HashScheme: leaf.MerkleHashScheme,
 	}
 }
 
@@ -552,6 +716,11 @@ func GetLabel(hash string) string {
 	return parts[0]
 }
 
+func labelNumber(hash string) int {
+	number, _ := strconv.Atoi(GetLabel(hash))
+	return number
+}
+
 func sortMapByKeys(inputMap map[string]string) map[string]string {
 	if inputMap == nil {
 		return inputMap
@@ -0,0 +1,137 @@
+package dag
+
+import (
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reads the recorded fields of the metadata, nil when no fields are recorded
+func readMetadata(path string, info fs.FileInfo, fields MetadataFields) (*FileMetadata, error) {
+	if fields == 0 {
+		return nil, nil
+	}
+
+	metadata := &FileMetadata{}
+
+	if fields&ModeMetadata != 0 {
+		mode := posixMode(info.Mode())
+		metadata.Mode = &mode
+	}
+
+	if fields&OwnerMetadata != 0 {
+		if uid, gid, ok := fileOwner(info); ok {
+			metadata.Uid = &uid
+			metadata.Gid = &gid
+		}
+	}
+
+	if fields&ModTimeMetadata != 0 {
+		modTime := info.ModTime().UnixNano()
+		metadata.ModTime = &modTime
+	}
+
+	if fields&XattrMetadata != 0 {
+		xattrs, err := readXattrs(path)
+		if err != nil {
+			return nil, err
+		}
+
+		metadata.Xattrs = xattrs
+	}
+
+	return metadata, nil
+}
+
+// Applies the recorded fields to the file or directory at path, limited by the options. Ownership
+// is only restored when permitted, the same way tar does for users other than root
+func (metadata *FileMetadata) restore(path string, options *ExtractOptions) error {
+	if metadata == nil {
+		return nil
+	}
+
+	if options.RestoreOwnership && metadata.Uid != nil && metadata.Gid != nil {
+		err := os.Lchown(path, int(*metadata.Uid), int(*metadata.Gid))
+		if err != nil && !os.IsPermission(err) {
+			return err
+		}
+	}
+
+	// Set before the mode, which could otherwise make the file read only
+	xattrs := []ExtendedAttribute{}
+	for _, xattr := range metadata.Xattrs {
+		if options.AllXattrs || restoredXattr(xattr.Name) {
+			xattrs = append(xattrs, xattr)
+		}
+	}
+
+	if len(xattrs) > 0 {
+		err := writeXattrs(path, xattrs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if metadata.Mode != nil {
+		mode := fileMode(*metadata.Mode) &^ (fs.ModeSetuid | fs.ModeSetgid)
+
+		err := os.Chmod(path, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if metadata.ModTime != nil {
+		modTime := time.Unix(0, *metadata.ModTime)
+
+		err := os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Extended attributes restored by default, anything else needs ExtractOptions.AllXattrs
+func restoredXattr(name string) bool {
+	return strings.HasPrefix(name, "user.") || strings.HasPrefix(name, "system.posix_acl_")
+}
+
+// Permission bits and setuid, setgid and sticky in their POSIX positions
+func posixMode(mode fs.FileMode) uint32 {
+	result := uint32(mode.Perm())
+
+	if mode&fs.ModeSetuid != 0 {
+		result |= 0o4000
+	}
+
+	if mode&fs.ModeSetgid != 0 {
+		result |= 0o2000
+	}
+
+	if mode&fs.ModeSticky != 0 {
+		result |= 0o1000
+	}
+
+	return result
+}
+
+func fileMode(mode uint32) fs.FileMode {
+	result := fs.FileMode(mode & 0o777)
+
+	if mode&0o4000 != 0 {
+		result |= fs.ModeSetuid
+	}
+
+	if mode&0o2000 != 0 {
+		result |= fs.ModeSetgid
+	}
+
+	if mode&0o1000 != 0 {
+		result |= fs.ModeSticky
+	}
+
+	return result
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package dag
+
+import (
+	"io/fs"
+)
+
+// Ownership is not recorded on platforms without POSIX owners
+func fileOwner(info fs.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
+
+func fileInode(info fs.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,180 @@
+package dag
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMetadata(t *testing.T) {
+	tmpDir, input := createTestInput(t, nil)
+
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	files := map[string]os.FileMode{
+		"bin/run.sh":   0755,
+		"readonly.txt": 0444,
+	}
+
+	for name, mode := range files {
+		writeTestFile(t, filepath.Join(input, filepath.FromSlash(name)), name)
+
+		err := os.Chmod(filepath.Join(input, name), mode)
+		if err != nil {
+			t.Fatalf("Could not change mode: %s", err)
+		}
+
+		err = os.Chtimes(filepath.Join(input, name), modTime, modTime)
+		if err != nil {
+			t.Fatalf("Could not change modification time: %s", err)
+		}
+	}
+
+	plain, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, leaf := range plain.Leafs {
+		if leaf.Metadata != nil {
+			t.Fatal("Metadata was recorded without being enabled")
+		}
+	}
+
+	SetRecordedMetadata(ModeMetadata | ModTimeMetadata)
+	defer SetRecordedMetadata(0)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if dag.Root == plain.Root {
+		t.Fatal("Recorded metadata is not part of the root")
+	}
+
+	err = dag.Verify()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, leaf := range dag.Leafs {
+		if leaf.Type != ChunkLeafType && (leaf.Metadata == nil || leaf.Metadata.Mode == nil || leaf.Metadata.ModTime == nil || leaf.Metadata.Uid != nil) {
+			t.Fatalf("Leaf %s does not have the selected metadata", leaf.ItemName)
+		}
+	}
+
+	// Changing a recorded field changes the leaf hash
+	readonly, err := dag.leafAtPath("readonly.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	tampered := readonly.Clone()
+	mode := uint32(0777)
+	tampered.Metadata = &FileMetadata{Mode: &mode, ModTime: readonly.Metadata.ModTime}
+	if tampered.VerifyLeaf() == nil {
+		t.Fatal("Leaf with tampered metadata verified")
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for name, mode := range files {
+		info, err := os.Stat(filepath.Join(output, name))
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		if info.Mode().Perm() != mode {
+			t.Fatalf("%s was restored with mode %s instead of %s", name, info.Mode().Perm(), mode)
+		}
+
+		if !info.ModTime().Equal(modTime) {
+			t.Fatalf("%s was restored with modification time %s", name, info.ModTime())
+		}
+	}
+}
+
+func TestRestoredOwnershipAndMode(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{"bin/run": "run"})
+	file := filepath.Join(input, "bin", "run")
+
+	// Owned by someone else, with the setuid and setgid bits set
+	const uid, gid = 12345, 12346
+
+	err := os.Lchown(file, uid, gid)
+	if err != nil {
+		t.Skipf("Ownership can not be changed here: %s", err)
+	}
+
+	err = os.Chmod(file, 0755|fs.ModeSetuid|fs.ModeSetgid)
+	if err != nil {
+		t.Fatalf("Could not change mode: %s", err)
+	}
+
+	SetRecordedMetadata(PosixMetadata)
+	defer SetRecordedMetadata(0)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	leaf, err := dag.leafAtPath("bin/run")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if leaf.Metadata == nil || leaf.Metadata.Uid == nil || *leaf.Metadata.Uid != uid || *leaf.Metadata.Mode != 0o6755 {
+		t.Fatalf("Unexpected metadata %v", leaf.Metadata)
+	}
+
+	restored := func(path string) (fs.FileMode, uint32) {
+		info, err := os.Lstat(path)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		owner, _, ok := fileOwner(info)
+		if !ok {
+			t.Skip("File owners are not supported here")
+		}
+
+		return info.Mode(), owner
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.Extract(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	mode, owner := restored(filepath.Join(output, "bin", "run"))
+	if owner == uid {
+		t.Fatal("Owner from the dag was restored by default")
+	}
+
+	if mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 || mode.Perm() != 0755 {
+		t.Fatalf("File was restored with mode %s", mode)
+	}
+
+	output = filepath.Join(tmpDir, "owned")
+	err = dag.Extract(output, &ExtractOptions{RestoreOwnership: true})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	mode, owner = restored(filepath.Join(output, "bin", "run"))
+	if owner != uid {
+		t.Fatal("Owner was not restored with RestoreOwnership")
+	}
+
+	if mode&(fs.ModeSetuid|fs.ModeSetgid) != 0 {
+		t.Fatalf("Setuid and setgid bits were restored with mode %s", mode)
+	}
+}
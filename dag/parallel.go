@@ -0,0 +1,428 @@
+package dag
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Chunks each worker may hash ahead of the walk, a file with more chunks takes all of them
+const chunksAheadPerWorker = 4
+
+// Chunks and small files hashed ahead of the sequential walk, which only assigns the labels
+type hashedFile struct {
+	path        string
+	name        string
+	size        int64
+	chunks      []*DagLeaf // Unlabelled, nil for files stored in a single leaf
+	data        []byte
+	contentHash []byte
+	errs        []error
+	remaining   int32
+	done        chan struct{}
+
+	// Guarded by the mutex of the pool. A file the walk reaches before it was dispatched is read
+	// by the walk instead, a dispatched file holds its slots until the walk releases it
+	dispatched bool
+	claimed    bool
+	slots      int
+}
+
+// Listing of a directory handed to the walk, so every directory is only read once
+type hashedDir struct {
+	path    string
+	entries []fs.DirEntry
+	err     error
+	skipped bool     // Not listed by the pool, the walk lists it itself
+	files   []string // Paths of the files hashed ahead
+}
+
+type hashJob struct {
+	file   *hashedFile
+	index  int
+	offset int64
+	size   int
+}
+
+type hashPool struct {
+	// Settings of the build, the pool may still be stopping after it returned
+	chunkSize       int
+	symlinkHandling SymlinkMode
+
+	mutex  sync.Mutex
+	files  map[string]*hashedFile
+	listed map[string]bool // Directories whose listing is on its way to the walk
+	dirs   chan *hashedDir
+	jobs   chan hashJob
+	slots  chan struct{}
+	stop   chan struct{}
+}
+
+// Hashes the regular files under the path on the given number of workers while the dag is built.
+// The pool lists the directories in the order the walk visits them and hands the listings to the
+// walk. Each worker reads a single chunk at a time, and the chunks that were hashed but not yet
+// added to the dag take a slot each, so hashing only runs a bounded distance ahead of the walk
+func startHashPool(path string, dag *DagBuilder, workers int) *hashPool {
+	p := &hashPool{
+		chunkSize:       ChunkSize,
+		symlinkHandling: SymlinkHandling,
+		files:           map[string]*hashedFile{},
+		listed:          map[string]bool{},
+		dirs:            make(chan *hashedDir, workers),
+		jobs:            make(chan hashJob, workers),
+		slots:           make(chan struct{}, workers*chunksAheadPerWorker),
+		stop:            make(chan struct{}),
+	}
+
+	entry, err := newDirEntry(path)
+	if err != nil {
+		close(p.dirs)
+		close(p.jobs)
+		return p
+	}
+
+	if entry.IsDir() {
+		p.listed[path] = true
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range p.jobs {
+				job.run()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(p.jobs)
+		defer close(p.dirs)
+
+		if !entry.IsDir() {
+			info, err := entry.Info()
+			if err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+				p.dispatch(p.add(path, entry.Name(), info.Size()))
+			}
+			return
+		}
+
+		p.walk(path, dag, map[string]bool{}, true)
+	}()
+
+	return p
+}
+
+// Mirrors the walk of processDirectory, anything it cannot read is left to the sequential walk
+// which reports the error. Returns false once the pool is closed
+func (p *hashPool) walk(dirPath string, dag *DagBuilder, directories map[string]bool, isRoot bool) bool {
+	dir := &hashedDir{path: dirPath}
+
+	if p.symlinkHandling == FollowSymlinks {
+		realPath, err := filepath.EvalSymlinks(dirPath)
+		if err != nil || directories[realPath] {
+			dir.skipped = true
+			return p.send(dir)
+		}
+
+		directories[realPath] = true
+		defer delete(directories, realPath)
+	}
+
+	dir.entries, dir.err = os.ReadDir(dirPath)
+
+	// Files and directories are registered before the walk gets the listing, so it knows what
+	// to wait for
+	children := []string{}
+	files := map[string]*hashedFile{}
+	for _, child := range dir.entries {
+		if isRoot && dag.skipManifest && child.Name() == ManifestFileName {
+			continue
+		}
+
+		childPath := filepath.Join(dirPath, child.Name())
+
+		if child.Type()&fs.ModeSymlink != 0 {
+			if p.symlinkHandling != FollowSymlinks {
+				continue
+			}
+
+			var err error
+			child, err = newDirEntry(childPath)
+			if err != nil {
+				continue
+			}
+		}
+
+		if child.IsDir() {
+			p.mutex.Lock()
+			p.listed[childPath] = true
+			p.mutex.Unlock()
+
+			children = append(children, childPath)
+			continue
+		}
+
+		info, err := child.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+			continue
+		}
+
+		if dag.cache != nil && dag.cache.unchanged(childPath, info) {
+			continue
+		}
+
+		files[childPath] = p.add(childPath, child.Name(), info.Size())
+		dir.files = append(dir.files, childPath)
+		children = append(children, childPath)
+	}
+
+	if !p.send(dir) {
+		return false
+	}
+
+	for _, childPath := range children {
+		var running bool
+		if file, exists := files[childPath]; exists {
+			running = p.dispatch(file)
+		} else {
+			running = p.walk(childPath, dag, directories, false)
+		}
+
+		if !running {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *hashPool) send(dir *hashedDir) bool {
+	select {
+	case p.dirs <- dir:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+func (p *hashPool) add(entryPath string, name string, size int64) *hashedFile {
+	count := int((size + int64(p.chunkSize) - 1) / int64(p.chunkSize))
+
+	file := &hashedFile{
+		path:      entryPath,
+		name:      name,
+		size:      size,
+		errs:      make([]error, count),
+		remaining: int32(count),
+		done:      make(chan struct{}),
+	}
+
+	if count > 1 {
+		file.chunks = make([]*DagLeaf, count)
+	}
+
+	p.mutex.Lock()
+	p.files[entryPath] = file
+	p.mutex.Unlock()
+
+	return file
+}
+
+// Takes a slot for every chunk of the file, or all slots for a larger file, and queues its
+// chunks. Returns false once the pool is closed
+func (p *hashPool) dispatch(file *hashedFile) bool {
+	count := len(file.errs)
+
+	slots := count
+	if slots > cap(p.slots) {
+		slots = cap(p.slots)
+	}
+
+	for i := 0; i < slots; i++ {
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.stop:
+			return false
+		}
+	}
+
+	p.mutex.Lock()
+	claimed := file.claimed
+	if !claimed {
+		file.dispatched = true
+		file.slots = slots
+	}
+	p.mutex.Unlock()
+
+	if claimed {
+		p.free(slots)
+		return true
+	}
+
+	for i := 0; i < count; i++ {
+		offset := int64(i) * int64(p.chunkSize)
+		chunkSize := int64(p.chunkSize)
+		if offset+chunkSize > file.size {
+			chunkSize = file.size - offset
+		}
+
+		select {
+		case p.jobs <- hashJob{file: file, index: i, offset: offset, size: int(chunkSize)}:
+		case <-p.stop:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Takes the listing of the directory from the pool. Listings the walk went past are released, and
+// directories the pool did not register are listed by the walk
+func (p *hashPool) readDir(dirPath string) ([]fs.DirEntry, error) {
+	p.mutex.Lock()
+	listed := p.listed[dirPath]
+	delete(p.listed, dirPath)
+	p.mutex.Unlock()
+
+	if !listed {
+		return os.ReadDir(dirPath)
+	}
+
+	for dir := range p.dirs {
+		if dir.path == dirPath && !dir.skipped {
+			return dir.entries, dir.err
+		}
+
+		for _, filePath := range dir.files {
+			p.release(filePath)
+		}
+
+		if dir.path == dirPath {
+			break
+		}
+	}
+
+	return os.ReadDir(dirPath)
+}
+
+// Waits for the file to be hashed, nil when it was not hashed ahead or could not be read. A file
+// that was not dispatched yet is left to the walk instead of waiting for a slot
+func (p *hashPool) file(entryPath string) *hashedFile {
+	p.mutex.Lock()
+	file, exists := p.files[entryPath]
+	if exists && !file.dispatched {
+		file.claimed = true
+	}
+	p.mutex.Unlock()
+
+	if !exists || file.claimed {
+		return nil
+	}
+
+	<-file.done
+
+	for _, err := range file.errs {
+		if err != nil {
+			return nil
+		}
+	}
+
+	return file
+}
+
+// Frees the slots of the file once the walk is done with it, whether or not it was used
+func (p *hashPool) release(entryPath string) {
+	p.mutex.Lock()
+	file, exists := p.files[entryPath]
+	slots := 0
+	if exists {
+		delete(p.files, entryPath)
+		file.claimed = true
+		slots = file.slots
+		file.slots = 0
+	}
+	p.mutex.Unlock()
+
+	p.free(slots)
+}
+
+func (p *hashPool) free(slots int) {
+	for i := 0; i < slots; i++ {
+		<-p.slots
+	}
+}
+
+func (p *hashPool) close() {
+	close(p.stop)
+}
+
+func (job hashJob) run() {
+	job.file.errs[job.index] = job.hash()
+
+	if atomic.AddInt32(&job.file.remaining, -1) == 0 {
+		close(job.file.done)
+	}
+}
+
+func (job hashJob) hash() error {
+	file, err := os.Open(job.file.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data := make([]byte, job.size)
+	_, err = file.ReadAt(data, job.offset)
+	if err != nil {
+		return err
+	}
+
+	// The last chunk also checks that the file did not grow since it was listed
+	if job.offset+int64(job.size) == job.file.size {
+		n, _ := file.ReadAt(make([]byte, 1), job.file.size)
+		if n > 0 {
+			return fmt.Errorf("%s changed while it was hashed", job.file.path)
+		}
+	}
+
+	if job.file.chunks == nil {
+		hash := sha256.Sum256(data)
+		job.file.data = data
+		job.file.contentHash = hash[:]
+		return nil
+	}
+
+	chunkBuilder := CreateDagLeafBuilder(filepath.Join(job.file.name, strconv.Itoa(job.index)))
+
+	chunkBuilder.SetType(ChunkLeafType)
+	chunkBuilder.SetData(data)
+
+	chunkLeaf, err := chunkBuilder.BuildLeaf(nil)
+	if err != nil {
+		return err
+	}
+
+	job.file.chunks[job.index] = chunkLeaf
+
+	return nil
+}
+
+// Adds the chunks hashed by the pool, labelled in the same order the sequential walk uses
+func (file *hashedFile) addTo(builder *DagLeafBuilder, dag *DagBuilder) {
+	if file.chunks == nil {
+		builder.SetData(file.data)
+		builder.contentHash = file.contentHash
+		return
+	}
+
+	for _, chunkLeaf := range file.chunks {
+		label := dag.GetNextAvailableLabel()
+		builder.AddLink(label, chunkLeaf.Hash)
+		chunkLeaf.SetLabel(label)
+		dag.AddLeaf(chunkLeaf, nil)
+	}
+}
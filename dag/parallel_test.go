@@ -0,0 +1,140 @@
+package dag
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConcurrency(t *testing.T) {
+	SetChunkSize(8)
+	defer SetChunkSize(4096)
+
+	tmpDir, input := createTestInput(t, map[string]string{
+		"empty.txt": "",
+		"exact.txt": "8 bytes!",
+	})
+
+	GenerateDummyDirectory(input, 6, 3)
+
+	sequential, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	SetConcurrency(8)
+	defer SetConcurrency(1)
+
+	parallel, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = parallel.Verify()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if parallel.Root != sequential.Root || len(parallel.Leafs) != len(sequential.Leafs) {
+		t.Fatal("Parallel build does not give the same dag")
+	}
+
+	// Same labels, not just the same root
+	for hash := range sequential.Leafs {
+		if _, exists := parallel.Leafs[hash]; !exists {
+			t.Fatalf("Leaf %s is missing from the parallel build", hash)
+		}
+	}
+
+	cache := NewStatCache()
+	previous, err := CreateDagWithCache(input, nil, nil, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	cached, err := CreateDagWithCache(input, nil, previous, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if previous.Root != sequential.Root || cached.Root != sequential.Root {
+		t.Fatal("Parallel build with a stat cache does not give the same dag")
+	}
+
+	file, err := CreateDag(filepath.Join(input, "exact.txt"), false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	SetConcurrency(1)
+
+	sequentialFile, err := CreateDag(filepath.Join(input, "exact.txt"), false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if file.Root != sequentialFile.Root {
+		t.Fatal("Parallel build of a single file does not give the same dag")
+	}
+
+	// A file with more chunks than the pool has slots, followed by many small ones
+	many := filepath.Join(tmpDir, "many")
+	writeTestFile(t, filepath.Join(many, "big.txt"), strings.Repeat("big file", 25))
+
+	for i := 0; i < 40; i++ {
+		writeTestFile(t, filepath.Join(many, fmt.Sprintf("file%02d.txt", i)), fmt.Sprintf("two chunks %04d", i))
+	}
+
+	sequential, err = CreateDag(many, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	SetConcurrency(2)
+
+	parallel, err = CreateDag(many, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if parallel.Root != sequential.Root {
+		t.Fatal("Parallel build with more chunks than slots does not give the same dag")
+	}
+
+	// Without a walk taking the hashed files, the pool stops once its slots are taken
+	err = os.Remove(filepath.Join(many, "big.txt"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	pool := startHashPool(many, &DagBuilder{Leafs: map[string]*DagLeaf{}}, 2)
+	defer pool.close()
+
+	_, err = pool.readDir(many)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for deadline := time.Now().Add(time.Second); len(pool.slots) < cap(pool.slots) && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	hashed := 0
+	pool.mutex.Lock()
+	for _, file := range pool.files {
+		if file.dispatched {
+			<-file.done
+			hashed += len(file.errs)
+		}
+	}
+	pool.mutex.Unlock()
+
+	if hashed == 0 || hashed > cap(pool.slots) {
+		t.Fatalf("Pool hashed %d chunks ahead with %d slots", hashed, cap(pool.slots))
+	}
+}
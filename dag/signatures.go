@@ -0,0 +1,180 @@
+package dag
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+
+	"github.com/ipfs/go-cid"
+)
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+}
+
+func NewEd25519Signer(key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{key}
+}
+
+func (s *ed25519Signer) Type() SignatureType {
+	return Ed25519SignatureType
+}
+
+func (s *ed25519Signer) PublicKey() []byte {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func (s *ed25519Signer) Sign(message []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, message), nil
+}
+
+type schnorrSigner struct {
+	key *btcec.PrivateKey
+}
+
+// BIP-340 signer for a 32 byte secp256k1 private key, the public key is the 32 byte x-only key
+func NewSchnorrSigner(privateKey []byte) (Signer, error) {
+	if len(privateKey) != btcec.PrivKeyBytesLen {
+		return nil, fmt.Errorf("schnorr private key must be %d bytes", btcec.PrivKeyBytesLen)
+	}
+
+	key, _ := btcec.PrivKeyFromBytes(privateKey)
+
+	return &schnorrSigner{key}, nil
+}
+
+func (s *schnorrSigner) Type() SignatureType {
+	return SchnorrSignatureType
+}
+
+func (s *schnorrSigner) PublicKey() []byte {
+	return schnorr.SerializePubKey(s.key.PubKey())
+}
+
+func (s *schnorrSigner) Sign(message []byte) ([]byte, error) {
+	signature, err := schnorr.Sign(s.key, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return signature.Serialize(), nil
+}
+
+// Signatures cover the sha256 digest of the binary root CID, which BIP-340 requires to be 32 bytes
+func RootSignatureMessage(root string) ([]byte, error) {
+	c, err := cid.Decode(root)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode root cid: %w", err)
+	}
+
+	digest := sha256.Sum256(c.Bytes())
+
+	return digest[:], nil
+}
+
+func (dag *Dag) Sign(signer Signer) error {
+	message, err := RootSignatureMessage(dag.Root)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signer.Sign(message)
+	if err != nil {
+		return err
+	}
+
+	result := RootSignature{
+		Type:      signer.Type(),
+		PublicKey: signer.PublicKey(),
+		Signature: signature,
+	}
+
+	// Signing again with the same key replaces the previous signature
+	for i, existing := range dag.Signatures {
+		if existing.Type == result.Type && bytes.Equal(existing.PublicKey, result.PublicKey) {
+			dag.Signatures[i] = result
+			return nil
+		}
+	}
+
+	dag.Signatures = append(dag.Signatures, result)
+
+	return nil
+}
+
+// Succeeds when the root is signed by at least one of the trusted public keys, every signature
+// made by a trusted key must be valid
+func (dag *Dag) VerifySignature(pubkeys ...[]byte) error {
+	return verifyRootSignatures(dag.Root, dag.Signatures, pubkeys)
+}
+
+func verifyRootSignatures(root string, signatures []RootSignature, pubkeys [][]byte) error {
+	verified := false
+
+	for _, signature := range signatures {
+		trusted := false
+		for _, pubkey := range pubkeys {
+			if bytes.Equal(signature.PublicKey, pubkey) {
+				trusted = true
+				break
+			}
+		}
+
+		if !trusted {
+			continue
+		}
+
+		err := signature.Verify(root)
+		if err != nil {
+			return err
+		}
+
+		verified = true
+	}
+
+	if !verified {
+		return fmt.Errorf("root is not signed by any of the given public keys")
+	}
+
+	return nil
+}
+
+func (signature *RootSignature) Verify(root string) error {
+	message, err := RootSignatureMessage(root)
+	if err != nil {
+		return err
+	}
+
+	switch signature.Type {
+	case Ed25519SignatureType:
+		if len(signature.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("ed25519 public key must be %d bytes", ed25519.PublicKeySize)
+		}
+
+		if !ed25519.Verify(signature.PublicKey, message, signature.Signature) {
+			return fmt.Errorf("invalid ed25519 signature for root %s", root)
+		}
+	case SchnorrSignatureType:
+		pubkey, err := schnorr.ParsePubKey(signature.PublicKey)
+		if err != nil {
+			return fmt.Errorf("could not parse schnorr public key: %w", err)
+		}
+
+		parsed, err := schnorr.ParseSignature(signature.Signature)
+		if err != nil {
+			return fmt.Errorf("could not parse schnorr signature: %w", err)
+		}
+
+		if !parsed.Verify(message, pubkey) {
+			return fmt.Errorf("invalid schnorr signature for root %s", root)
+		}
+	default:
+		return fmt.Errorf("unknown signature type %q", signature.Type)
+	}
+
+	return nil
+}
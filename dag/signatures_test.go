@@ -0,0 +1,86 @@
+package dag
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignatures(t *testing.T) {
+	tmpDir, input := createTestInput(t, nil)
+	GenerateDummyDirectory(input, 3, 2)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	root := dag.Root
+
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	schnorrPrivateKey := make([]byte, 32)
+	_, err = rand.Read(schnorrPrivateKey)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	schnorrSigner, err := NewSchnorrSigner(schnorrPrivateKey)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, signer := range []Signer{NewEd25519Signer(edPrivateKey), schnorrSigner} {
+		err = dag.Sign(signer)
+		if err != nil {
+			t.Fatalf("Failed to sign dag: %s", err)
+		}
+	}
+
+	if dag.Root != root || dag.Verify() != nil {
+		t.Fatal("Signing changed the dag")
+	}
+
+	data, err := dag.ToCBOR()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(tmpDir, "signed.cbor"), data, 0644)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	dag, err = ReadDag(filepath.Join(tmpDir, "signed.cbor"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for _, pubkey := range [][]byte{edPublicKey, schnorrSigner.PublicKey()} {
+		err = dag.VerifySignature(pubkey)
+		if err != nil {
+			t.Fatalf("Signature failed to verify: %s", err)
+		}
+	}
+
+	otherPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = dag.VerifySignature(otherPublicKey)
+	if err == nil {
+		t.Fatal("Verified a signature for a key that did not sign")
+	}
+
+	dag.Signatures[1].Signature[0] ^= 0xff
+	err = dag.VerifySignature(schnorrSigner.PublicKey())
+	if err == nil {
+		t.Fatal("Tampered signature verified")
+	}
+}
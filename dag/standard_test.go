@@ -0,0 +1,42 @@
+package dag
+
+import (
+	"testing"
+
+	"github.com/HORNET-Storage/scionic-merkletree/merkletree"
+)
+
+func TestStandardMerkleTree(t *testing.T) {
+	_, input := createTestInput(t, nil)
+	GenerateDummyDirectory(input, 3, 3)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	tree, err := dag.StandardMerkleTree()
+	if err != nil {
+		t.Fatalf("Could not build standard merkle tree: %s", err)
+	}
+
+	if len(tree.Values) != len(dag.Leafs) {
+		t.Fatalf("Standard merkle tree has %d values but dag has %d leaves", len(tree.Values), len(dag.Leafs))
+	}
+
+	if tree.Values[0].Value[0] != dag.Root {
+		t.Fatal("First value of the standard merkle tree is not the dag root")
+	}
+
+	for i, value := range tree.Values {
+		proof, err := tree.Proof(i)
+		if err != nil {
+			t.Fatalf("Could not generate proof: %s", err)
+		}
+
+		err = merkletree.VerifyStandardProof(tree.Root(), tree.LeafEncoding, value.Value, proof)
+		if err != nil {
+			t.Fatalf("Proof for leaf %s failed to verify: %s", value.Value[0], err)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package dag
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/HORNET-Storage/scionic-merkletree/merkletree"
+
+	cbor "github.com/fxamacker/cbor/v2"
+)
+
+// Index of the files a dag was built from, like the git index. A file whose size, modification
+// time and inode have not changed is not read again, its chunks are taken from the previous dag
+type StatCache struct {
+	Root    string
+	Entries map[string]StatCacheEntry // By slash separated path relative to the dag root
+
+	// Chunks built with another chunk size or hash scheme have other CIDs and can not be reused
+	ChunkSize        int
+	MerkleHashScheme merkletree.TypeHashScheme
+
+	// Modification time of the cache file when it was loaded or saved. Like in git, files modified
+	// at or after it may have changed again within the same timestamp and are read again
+	saved time.Time
+}
+
+type StatCacheEntry struct {
+	Size    int64
+	ModTime int64 // Unix nanoseconds
+	Inode   uint64
+	Hash    string // label:cid of the file leaf in the dag of Root
+}
+
+type statCacheState struct {
+	cache    *StatCache
+	previous *Dag
+	rootPath string
+	entries  map[string]*DagLeaf
+	stats    map[string]StatCacheEntry
+}
+
+func NewStatCache() *StatCache {
+	return &StatCache{
+		Entries: map[string]StatCacheEntry{},
+	}
+}
+
+// A missing file gives an empty cache
+func LoadStatCache(path string) (*StatCache, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewStatCache(), nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Taken before the file is read, a cache saved in between only makes more entries racy
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := NewStatCache()
+
+	err = cbor.Unmarshal(data, cache)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.saved = info.ModTime()
+
+	return cache, nil
+}
+
+func (c *StatCache) Save(path string) error {
+	data, err := cbor.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	c.saved = info.ModTime()
+
+	return nil
+}
+
+// Builds the same dag as CreateDagAdvanced, reusing the chunks of unchanged files from previous,
+// the dag the cache was last updated with. The cache is updated with the new dag, its entries are
+// only trusted once it has been saved
+func CreateDagWithCache(path string, additionalData map[string]string, previous *Dag, cache *StatCache) (*Dag, error) {
+	dag := CreateDagBuilder()
+
+	dag.cache = &statCacheState{
+		cache:    cache,
+		previous: previous,
+		rootPath: path,
+		entries:  map[string]*DagLeaf{},
+		stats:    map[string]StatCacheEntry{},
+	}
+
+	// Entries recorded from another dag, or with other chunks, can not be used
+	if previous == nil || previous.Root != cache.Root || cache.ChunkSize != ChunkSize || cache.MerkleHashScheme != MerkleHashScheme {
+		dag.cache.cache = NewStatCache()
+	}
+
+	result, err := createDagWith(dag, path, additionalData)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]StatCacheEntry{}
+	for rel, leaf := range dag.cache.entries {
+		entry := dag.cache.stats[rel]
+		entry.Hash = leaf.Hash
+		entries[rel] = entry
+	}
+
+	cache.Root = result.Root
+	cache.Entries = entries
+	cache.ChunkSize = ChunkSize
+	cache.MerkleHashScheme = MerkleHashScheme
+	cache.saved = time.Time{}
+
+	return result, nil
+}
+
+// Adds the chunks of the file from the previous dag when its cache entry is still valid, the
+// chunks get new labels as their CIDs do not depend on them
+func (s *statCacheState) reuseFile(builder *DagLeafBuilder, entryPath string, info fs.FileInfo, dag *DagBuilder) (bool, error) {
+	rel, err := filepath.Rel(s.rootPath, entryPath)
+	if err != nil {
+		return false, err
+	}
+	rel = filepath.ToSlash(rel)
+
+	stat := statCacheEntry(info)
+	s.stats[rel] = stat
+
+	entry, exists := s.cached(rel, stat)
+	if !exists {
+		return false, nil
+	}
+
+	previousLeaf, exists := s.previous.Leafs[entry.Hash]
+	if !exists || previousLeaf.Type != FileLeafType {
+		return false, nil
+	}
+
+	chunks := []*DagLeaf{}
+	err = s.previous.iterateChildren(previousLeaf, func(chunk *DagLeaf) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return false, nil
+	}
+
+	if len(chunks) == 0 {
+		if previousLeaf.ContentHash != nil && previousLeaf.Content == nil {
+			return false, nil
+		}
+
+		builder.SetData(previousLeaf.Content)
+		builder.contentHash = previousLeaf.ContentHash
+
+		return true, nil
+	}
+
+	for _, chunk := range chunks {
+		if chunk.Content == nil {
+			return false, nil
+		}
+	}
+
+	for _, chunk := range chunks {
+		chunkLeaf := chunk.Clone()
+		chunkLeaf.Hash = GetHash(chunk.Hash)
+
+		label := dag.GetNextAvailableLabel()
+		builder.AddLink(label, chunkLeaf.Hash)
+		chunkLeaf.SetLabel(label)
+		dag.AddLeaf(chunkLeaf, nil)
+	}
+
+	return true, nil
+}
+
+// Whether the cache entry of the file is still valid, without recording its stats
+func (s *statCacheState) unchanged(entryPath string, info fs.FileInfo) bool {
+	rel, err := filepath.Rel(s.rootPath, entryPath)
+	if err != nil {
+		return false
+	}
+
+	_, exists := s.cached(filepath.ToSlash(rel), statCacheEntry(info))
+
+	return exists
+}
+
+// The entry of the file when its stats still match and it is not racy
+func (s *statCacheState) cached(rel string, stat StatCacheEntry) (StatCacheEntry, bool) {
+	entry, exists := s.cache.Entries[rel]
+	if !exists || !entry.matches(stat) || entry.ModTime >= s.cache.saved.UnixNano() {
+		return StatCacheEntry{}, false
+	}
+
+	return entry, true
+}
+
+func statCacheEntry(info fs.FileInfo) StatCacheEntry {
+	return StatCacheEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   fileInode(info),
+	}
+}
+
+func (entry StatCacheEntry) matches(stat StatCacheEntry) bool {
+	return entry.Size == stat.Size && entry.ModTime == stat.ModTime && entry.Inode == stat.Inode
+}
+
+// Remembers the leaf so its labelled hash can be recorded once the parent has labelled it
+func (s *statCacheState) record(entryPath string, leaf *DagLeaf) {
+	rel, err := filepath.Rel(s.rootPath, entryPath)
+	if err != nil {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+
+	if _, exists := s.stats[rel]; exists {
+		s.entries[rel] = leaf
+	}
+}
@@ -0,0 +1,186 @@
+package dag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatCache(t *testing.T) {
+	SetChunkSize(8)
+	defer SetChunkSize(4096)
+
+	tmpDir, input := createTestInput(t, nil)
+	oldTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	writeFile := func(name string, content string) {
+		writeTestFile(t, filepath.Join(input, name), content)
+
+		// Files modified at or after the cache was saved are read again
+		err := os.Chtimes(filepath.Join(input, name), oldTime, oldTime)
+		if err != nil {
+			t.Fatalf("Could not change modification time: %s", err)
+		}
+	}
+
+	writeFile("a.txt", "a file split into chunks")
+	writeFile("b.txt", "small")
+	writeFile("sub/c.txt", "another file split into chunks")
+	writeFile("sub/d.txt", "tiny")
+
+	cacheFile := filepath.Join(tmpDir, "index")
+	cache, err := LoadStatCache(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	previous, err := CreateDagWithCache(input, nil, nil, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	full, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if previous.Root != full.Root || len(cache.Entries) != 4 {
+		t.Fatal("Building with an empty cache does not give the same dag")
+	}
+
+	err = cache.Save(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	cache, err = LoadStatCache(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// The first file gets more chunks, which shifts the labels of every chunk after it
+	writeFile("a.txt", "a file split into even more chunks than before")
+	writeFile("sub/e.txt", "new")
+
+	// Content changed behind the cache's back, keeping the size, modification time and inode
+	writeFile("sub/d.txt", "TINY")
+
+	dag, err := CreateDagWithCache(input, nil, previous, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = dag.Verify()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	d, err := dag.leafAtPath("sub/d.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if string(d.Content) != "tiny" {
+		t.Fatal("Unchanged file was read again instead of reused")
+	}
+
+	writeFile("sub/d.txt", "tiny")
+
+	full, err = CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if dag.Root != full.Root {
+		t.Fatal("Building with the cache does not give the same root as a full build")
+	}
+
+	if cache.Root != dag.Root || len(cache.Entries) != 5 {
+		t.Fatal("Cache was not updated")
+	}
+
+	err = cache.Save(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// Chunks built with another chunk size are not reused
+	SetChunkSize(16)
+	defer SetChunkSize(4096)
+
+	resized, err := CreateDagWithCache(input, nil, dag, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	full, err = CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if resized.Root != full.Root || cache.ChunkSize != 16 {
+		t.Fatal("Cache built with another chunk size was used")
+	}
+
+	err = cache.Save(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// Entries of another dag are ignored
+	writeFile("sub/d.txt", "TINY")
+
+	other, err := CreateDagWithCache(input, nil, previous, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	d, err = other.leafAtPath("sub/d.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if string(d.Content) != "TINY" {
+		t.Fatal("Cache of another dag was used")
+	}
+
+	// A file modified after the cache was saved could change again within the same timestamp
+	racyTime := time.Now().Add(time.Hour)
+	writeRacyFile := func(content string) {
+		writeTestFile(t, filepath.Join(input, "sub/d.txt"), content)
+
+		err := os.Chtimes(filepath.Join(input, "sub/d.txt"), racyTime, racyTime)
+		if err != nil {
+			t.Fatalf("Could not change modification time: %s", err)
+		}
+	}
+
+	writeRacyFile("tiny")
+
+	resized, err = CreateDagWithCache(input, nil, other, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = cache.Save(cacheFile)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	writeRacyFile("TINY")
+
+	racy, err := CreateDagWithCache(input, nil, resized, cache)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	d, err = racy.leafAtPath("sub/d.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if string(d.Content) != "TINY" {
+		t.Fatal("Racy file was reused")
+	}
+}
@@ -0,0 +1,322 @@
+package dag
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	cbor "github.com/fxamacker/cbor/v2"
+)
+
+// Written to the root of an extracted directory and ignored by Status
+const ManifestFileName = ".dag"
+
+// Everything Status needs to compare an extracted directory, without a copy of its content
+type DagManifest struct {
+	Dag          *Dag             // Leaves of files and chunks are stored without their content
+	ContentSizes map[string]int64 // Content size of every file and chunk leaf by CID
+	Files        *StatCache
+}
+
+type StatusOptions struct {
+	// Files whose size and modification time match the stat cache entry, or the recorded
+	// metadata, of their leaf are not hashed
+	Fast  bool
+	Cache *StatCache
+}
+
+// Paths are relative to the directory, an added or removed directory is a single entry
+type StatusEntry struct {
+	Type DiffType
+	Path string
+	Leaf *DagLeaf // Nil for added entries
+}
+
+// Compares the directory against the manifest written into it when it was extracted
+func Status(dir string, options *StatusOptions) ([]StatusEntry, error) {
+	manifest, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	statusOptions := StatusOptions{Cache: manifest.Files}
+	if options != nil {
+		statusOptions.Fast = options.Fast
+		if options.Cache != nil {
+			statusOptions.Cache = options.Cache
+		}
+	}
+
+	return manifest.Dag.status(dir, &statusOptions, manifest.ContentSizes)
+}
+
+// Reports the files and directories that were added to, removed from or modified in the
+// directory compared to the dag. Files are compared by their content
+func (dag *Dag) Status(dir string, options *StatusOptions) ([]StatusEntry, error) {
+	return dag.status(dir, options, nil)
+}
+
+func (dag *Dag) status(dir string, options *StatusOptions, sizes map[string]int64) ([]StatusEntry, error) {
+	rootLeaf, exists := dag.Leafs[dag.Root]
+	if !exists {
+		return nil, fmt.Errorf("root %s is missing from dag", dag.Root)
+	}
+
+	s := &statusWalker{
+		dag:   dag,
+		sizes: sizes,
+	}
+
+	if options != nil {
+		s.options = *options
+	}
+
+	// Cache entries of another dag do not describe these leaves
+	if s.options.Cache != nil && s.options.Cache.Root != dag.Root {
+		s.options.Cache = nil
+	}
+
+	_, err := ReadManifest(dir)
+	s.skipManifest = err == nil
+
+	err = s.compare(rootLeaf, dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].Path < s.entries[j].Path
+	})
+
+	return s.entries, nil
+}
+
+func ReadManifest(dir string) (*DagManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest DagManifest
+	err = cbor.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode manifest: %w", err)
+	}
+
+	if manifest.Dag == nil {
+		return nil, fmt.Errorf("manifest does not contain a dag")
+	}
+
+	return &manifest, nil
+}
+
+func newManifest(dag *Dag, files *StatCache) *DagManifest {
+	manifest := &DagManifest{
+		Dag: &Dag{
+			Root:       dag.Root,
+			Leafs:      map[string]*DagLeaf{},
+			Signatures: dag.Signatures,
+		},
+		ContentSizes: map[string]int64{},
+		Files:        files,
+	}
+
+	// Symlink leaves keep their target, Status compares it
+	for hash, leaf := range dag.Leafs {
+		skeleton := leaf.Clone()
+
+		if leaf.Type == FileLeafType || leaf.Type == ChunkLeafType {
+			manifest.ContentSizes[hash] = int64(len(leaf.Content))
+			skeleton.Content = nil
+		}
+
+		manifest.Dag.Leafs[hash] = skeleton
+	}
+
+	return manifest
+}
+
+func writeManifest(dir string, manifest *DagManifest) error {
+	data, err := cbor.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, ManifestFileName), data, 0644)
+}
+
+type statusWalker struct {
+	dag     *Dag
+	options StatusOptions
+	sizes   map[string]int64 // Content sizes of the leaves of a manifest
+	entries []StatusEntry
+
+	// Set when the directory holds a manifest, which is not part of the dag
+	skipManifest bool
+}
+
+func (s *statusWalker) compare(leaf *DagLeaf, filePath string, rel string) error {
+	var info os.FileInfo
+	var err error
+
+	// Symlinks are only stored as symlink leaves when they were preserved, otherwise they were followed
+	if leaf.Type == SymlinkLeafType {
+		info, err = os.Lstat(filePath)
+	} else {
+		info, err = os.Stat(filePath)
+	}
+
+	if os.IsNotExist(err) {
+		s.add(RemovedDiff, rel, leaf)
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	switch leaf.Type {
+	case DirectoryLeafType:
+		if !info.IsDir() {
+			s.add(ModifiedDiff, rel, leaf)
+			return nil
+		}
+
+		return s.compareDirectory(leaf, filePath, rel)
+	case FileLeafType:
+		if !info.Mode().IsRegular() {
+			s.add(ModifiedDiff, rel, leaf)
+			return nil
+		}
+
+		unchanged, err := s.compareFile(leaf, filePath, rel, info)
+		if err != nil {
+			return err
+		}
+
+		if !unchanged {
+			s.add(ModifiedDiff, rel, leaf)
+		}
+	case SymlinkLeafType:
+		target, err := os.Readlink(filePath)
+		if err != nil || target != string(leaf.Content) {
+			s.add(ModifiedDiff, rel, leaf)
+		}
+	default:
+		return fmt.Errorf("leaf %s has unknown type %q", leaf.Hash, leaf.Type)
+	}
+
+	return nil
+}
+
+func (s *statusWalker) compareDirectory(leaf *DagLeaf, dirPath string, rel string) error {
+	children, err := childrenByName(leaf, s.dag)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
+	onDisk := map[string]bool{}
+	for _, entry := range entries {
+		if rel == "" && s.skipManifest && entry.Name() == ManifestFileName {
+			continue
+		}
+
+		onDisk[entry.Name()] = true
+
+		if _, exists := children[entry.Name()]; !exists {
+			s.add(AddedDiff, path.Join(rel, entry.Name()), nil)
+		}
+	}
+
+	for name, child := range children {
+		childRel := path.Join(rel, name)
+
+		if !onDisk[name] {
+			s.add(RemovedDiff, childRel, child)
+			continue
+		}
+
+		err := s.compare(child, filepath.Join(dirPath, name), childRel)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *statusWalker) compareFile(leaf *DagLeaf, filePath string, rel string, info os.FileInfo) (bool, error) {
+	chunks := []*DagLeaf{}
+	err := s.dag.iterateChildren(leaf, func(chunk *DagLeaf) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	if len(chunks) == 0 {
+		chunks = append(chunks, leaf)
+	}
+
+	var size int64
+	sizes := make([]int64, len(chunks))
+	for i, chunk := range chunks {
+		chunkSize, err := s.contentSize(chunk)
+		if err != nil {
+			return false, err
+		}
+
+		sizes[i] = chunkSize
+		size += chunkSize
+	}
+
+	if s.options.Fast && info.Size() == size {
+		key := rel
+		if key == "" {
+			key = "."
+		}
+
+		if s.options.Cache != nil {
+			entry, exists := s.options.Cache.Entries[key]
+			if exists && entry.Hash == leaf.Hash && entry.ModTime == info.ModTime().UnixNano() && entry.Inode == fileInode(info) {
+				return true, nil
+			}
+		}
+
+		if leaf.Metadata != nil && leaf.Metadata.ModTime != nil && *leaf.Metadata.ModTime == info.ModTime().UnixNano() {
+			return true, nil
+		}
+	}
+
+	return matchesChunks(filePath, chunks, sizes), nil
+}
+
+// Size of the leaf's content, taken from the manifest when the content was left out of it
+func (s *statusWalker) contentSize(leaf *DagLeaf) (int64, error) {
+	if leaf.Content == nil && leaf.ContentHash != nil {
+		size, exists := s.sizes[leaf.Hash]
+		if !exists {
+			return 0, fmt.Errorf("content of leaf %s is missing from dag", leaf.Hash)
+		}
+
+		return size, nil
+	}
+
+	return int64(len(leaf.Content)), nil
+}
+
+func (s *statusWalker) add(diffType DiffType, rel string, leaf *DagLeaf) {
+	s.entries = append(s.entries, StatusEntry{
+		Type: diffType,
+		Path: rel,
+		Leaf: leaf,
+	})
+}
@@ -0,0 +1,183 @@
+package dag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	SetChunkSize(8)
+	defer SetChunkSize(4096)
+
+	tmpDir, input := createTestInput(t, map[string]string{
+		"a.txt":       "a file split into chunks",
+		"empty.txt":   "",
+		"same.txt":    "same size",
+		"sub/b.txt":   "b",
+		"gone/c.txt":  "c",
+		"gone/d/e.md": "e",
+	})
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	entries, err := dag.Status(input, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("Unchanged directory has %d status entries", len(entries))
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.Extract(output, &ExtractOptions{WriteManifest: true})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	entries, err = Status(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("Extracted directory has %d status entries", len(entries))
+	}
+
+	// The manifest holds no copy of the content and is not part of the extracted dag
+	manifest, err := ReadManifest(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	for hash, leaf := range manifest.Dag.Leafs {
+		if leaf.Content != nil {
+			t.Fatalf("Manifest holds the content of leaf %s", hash)
+		}
+
+		if leaf.Type == ChunkLeafType && manifest.ContentSizes[hash] != int64(len(dag.Leafs[hash].Content)) {
+			t.Fatalf("Manifest has the wrong size for leaf %s", hash)
+		}
+	}
+
+	// The root leaf is named after the directory, so compare with an extraction of the same name
+	plain := filepath.Join(tmpDir, "plain", "output")
+	err = os.Mkdir(filepath.Dir(plain), 0755)
+	if err != nil {
+		t.Fatalf("Could not create directory: %s", err)
+	}
+
+	err = dag.Extract(plain, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	extracted, err := CreateDag(output, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	plainDag, err := CreateDag(plain, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if extracted.Root != plainDag.Root {
+		t.Fatal("Manifest was added to the dag of the extracted directory")
+	}
+
+	writeTestFile(t, filepath.Join(output, "a.txt"), "a file split into more chunks")
+	writeTestFile(t, filepath.Join(output, "sub", "new.txt"), "new")
+
+	err = os.RemoveAll(filepath.Join(output, "gone"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	// Only found by hashing, the size and modification time stay the same
+	info, err := os.Stat(filepath.Join(output, "same.txt"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	writeTestFile(t, filepath.Join(output, "same.txt"), "SAME SIZE")
+
+	err = os.Chtimes(filepath.Join(output, "same.txt"), info.ModTime(), info.ModTime())
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	format := func(entries []StatusEntry) string {
+		result := []string{}
+		for _, entry := range entries {
+			result = append(result, string(entry.Type)+" "+entry.Path)
+		}
+
+		return strings.Join(result, ", ")
+	}
+
+	entries, err = Status(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	expected := "modified a.txt, removed gone, modified same.txt, added sub/new.txt"
+	if format(entries) != expected {
+		t.Fatalf("Unexpected status %q", format(entries))
+	}
+
+	entries, err = Status(output, &StatusOptions{Fast: true})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	expected = "modified a.txt, removed gone, added sub/new.txt"
+	if format(entries) != expected {
+		t.Fatalf("Unexpected fast status %q", format(entries))
+	}
+
+	if dag.ExtractLeaf("sub", filepath.Join(tmpDir, "leaf"), &ExtractOptions{WriteManifest: true}) == nil {
+		t.Fatal("Wrote a manifest for a leaf that is not the root")
+	}
+}
+
+func TestPlainDagFileIsKept(t *testing.T) {
+	_, input := createTestInput(t, map[string]string{
+		".dag":     "not a manifest",
+		"file.txt": "content",
+	})
+
+	for _, concurrency := range []int{1, 4} {
+		SetConcurrency(concurrency)
+
+		dag, err := CreateDag(input, false)
+		SetConcurrency(1)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		leaf, err := dag.leafAtPath(ManifestFileName)
+		if err != nil {
+			t.Fatalf("Plain %s file was left out with concurrency %d", ManifestFileName, concurrency)
+		}
+
+		content, err := dag.GetContentFromLeaf(leaf)
+		if err != nil || string(content) != "not a manifest" {
+			t.Fatalf("Plain %s file holds %q", ManifestFileName, content)
+		}
+
+		entries, err := dag.Status(input, nil)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		if len(entries) != 0 {
+			t.Fatalf("Unexpected status %v", entries)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package dag
+
+import (
+	"fmt"
+	"sync"
+)
+
+type DagStore interface {
+	PutDag(dag *Dag) error
+	GetDag(root string) (*Dag, error)
+	ApplyDeletionManifest(manifest *DeletionManifest, pubkeys ...[]byte) error
+}
+
+type MemoryDagStore struct {
+	dags      map[string]*Dag
+	deletions []storeDeletion
+	mu        sync.RWMutex
+}
+
+// Leaves, by labelled hash, deleted by the revision root since previousRoot. They are hidden from
+// previousRoot and the revisions before it, never from the revision that deleted them or the ones
+// after it
+type storeDeletion struct {
+	root         string
+	previousRoot string
+	hashes       map[string]bool
+}
+
+func NewMemoryDagStore() *MemoryDagStore {
+	return &MemoryDagStore{
+		dags: map[string]*Dag{},
+	}
+}
+
+func (s *MemoryDagStore) PutDag(dag *Dag) error {
+	if dag.Root == "" {
+		return fmt.Errorf("dag has no root")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dags[dag.Root] = dag
+
+	return nil
+}
+
+// Deleted leaves are left out of the returned dag, their parents are kept the same way as in a partial dag
+func (s *MemoryDagStore) GetDag(root string) (*Dag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dag, exists := s.dags[root]
+	if !exists {
+		return nil, fmt.Errorf("dag %s not found in store", root)
+	}
+
+	deleted := s.deletedFrom(root)
+
+	if deleted[root] {
+		return nil, fmt.Errorf("dag %s has been deleted", root)
+	}
+
+	if len(deleted) == 0 {
+		return dag, nil
+	}
+
+	return dag.withoutLeafs(deleted), nil
+}
+
+// Collects the leaves deleted by the later revisions of root. Leaves whose CID is still part of the
+// revision that deleted them are kept, it may have been stored after the manifest was applied
+func (s *MemoryDagStore) deletedFrom(root string) map[string]bool {
+	deleted := map[string]bool{}
+
+	for _, deletion := range s.deletions {
+		if !s.precedes(root, deletion.previousRoot) {
+			continue
+		}
+
+		live := map[string]bool{}
+		if current, exists := s.dags[deletion.root]; exists {
+			for hash := range current.Leafs {
+				live[GetHash(hash)] = true
+			}
+		}
+
+		for hash := range deletion.hashes {
+			if !live[GetHash(hash)] {
+				deleted[hash] = true
+			}
+		}
+	}
+
+	return deleted
+}
+
+// Whether root is revision itself or one of the revisions before it in the store
+func (s *MemoryDagStore) precedes(root string, revision string) bool {
+	visited := map[string]bool{}
+
+	for revision != "" && !visited[revision] {
+		if revision == root {
+			return true
+		}
+		visited[revision] = true
+
+		dag, exists := s.dags[revision]
+		if !exists {
+			return false
+		}
+
+		revision = dag.PreviousRoot()
+	}
+
+	return false
+}
+
+// Stops serving the leaves the manifest deletes from its previous revision, and the revisions before
+// it, once it is verified against the trusted public keys. Paths and bare CIDs are resolved against
+// the previous revision, which must be in the store unless every entry is a labelled hash. Leaves
+// that are still part of the revision of the manifest are kept
+func (s *MemoryDagStore) ApplyDeletionManifest(manifest *DeletionManifest, pubkeys ...[]byte) error {
+	err := manifest.Verify(pubkeys...)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted map[string]bool
+
+	previous, exists := s.dags[manifest.PreviousRoot]
+	if exists {
+		deleted, err = previous.deletedLeafs(&manifest.MetaData)
+		if err != nil {
+			return err
+		}
+	} else {
+		hashes, paths := manifest.deletedEntries()
+		for hash := range hashes {
+			if !HasLabel(hash) {
+				paths[hash] = true
+			}
+		}
+
+		if len(paths) > 0 {
+			return fmt.Errorf("previous revision %s is needed to resolve deleted paths and CIDs", manifest.PreviousRoot)
+		}
+
+		deleted = hashes
+	}
+
+	s.deletions = append(s.deletions, storeDeletion{
+		root:         manifest.Root,
+		previousRoot: manifest.PreviousRoot,
+		hashes:       deleted,
+	})
+
+	return nil
+}
@@ -0,0 +1,109 @@
+package dag
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymlinks(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{"dir/file.txt": "content"})
+	defer SetSymlinkHandling(FollowSymlinks)
+
+	err := os.Symlink("file.txt", filepath.Join(input, "dir", "link.txt"))
+	if err != nil {
+		t.Fatalf("Could not create symlink: %s", err)
+	}
+
+	err = os.Symlink("dir", filepath.Join(input, "linked"))
+	if err != nil {
+		t.Fatalf("Could not create symlink: %s", err)
+	}
+
+	SetSymlinkHandling(PreserveSymlinks)
+
+	preserved, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	link, err := preserved.leafAtPath("dir/link.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if link.Type != SymlinkLeafType || string(link.Content) != "file.txt" {
+		t.Fatal("Symlink was not preserved")
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = preserved.CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	target, err := os.Readlink(filepath.Join(output, "linked"))
+	if err != nil || target != "dir" {
+		t.Fatal("Symlink was not recreated")
+	}
+
+	SetSymlinkHandling(SkipSymlinks)
+
+	skipped, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(skipped.Leafs) != 3 {
+		t.Fatalf("Expected 3 leaves without symlinks, got %d", len(skipped.Leafs))
+	}
+
+	SetSymlinkHandling(FollowSymlinks)
+
+	followed, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	copied, err := followed.leafAtPath("linked/link.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if copied.Type != FileLeafType || string(copied.Content) != "content" {
+		t.Fatal("Symlinks were not followed")
+	}
+
+	err = os.Symlink("..", filepath.Join(input, "dir", "parent"))
+	if err != nil {
+		t.Fatalf("Could not create symlink: %s", err)
+	}
+
+	_, err = CreateDag(input, false)
+	if err == nil {
+		t.Fatal("Followed a symlink loop")
+	}
+
+	// Symlinks pointing outside of the output directory are refused
+	err = os.Remove(filepath.Join(input, "dir", "parent"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = os.Symlink("../../outside", filepath.Join(input, "dir", "escape"))
+	if err != nil {
+		t.Fatalf("Could not create symlink: %s", err)
+	}
+
+	SetSymlinkHandling(PreserveSymlinks)
+
+	escaping, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	err = escaping.CreateDirectory(filepath.Join(tmpDir, "escaped"))
+	if err == nil {
+		t.Fatal("Created a symlink pointing outside of the output directory")
+	}
+}
@@ -6,21 +6,80 @@ import (
 
 var ChunkSize = 2048 * 1024 // 2048 * 1024 bytes = 2 megabytes
 
+var MerkleHashScheme = merkletree.HashSchemeLegacy
+
+// No metadata is recorded by default so the root only depends on names and content
+var RecordedMetadata MetadataFields = 0
+
+var SymlinkHandling = FollowSymlinks
+
+// Number of workers reading and hashing files while a dag is built, 1 builds it on a single goroutine.
+// Labels are still assigned in walk order so the dag is the same for any number of workers
+var Concurrency = 1
+
+// Root additional data key holding the root CID of the previous revision
+const PreviousRootKey = "previous_root"
+
+// Root additional data key holding the JSON encoded MetaData of a revision that deletes leaves
+const DeletedKey = "deleted"
+
 type LeafType string
 
 const (
 	FileLeafType      LeafType = "file"
 	ChunkLeafType     LeafType = "chunk"
 	DirectoryLeafType LeafType = "directory"
+	SymlinkLeafType   LeafType = "symlink"
+)
+
+// How symlinks are handled when building a dag from disk
+type SymlinkMode int
+
+const (
+	// Hashes what the symlink points to under the name of the symlink, directories that loop back
+	// to one of their parents are an error
+	FollowSymlinks SymlinkMode = iota
+	// Stores the symlink as a symlink leaf whose content is the link target
+	PreserveSymlinks
+	SkipSymlinks
 )
 
 type Dag struct {
-	Root  string
-	Leafs map[string]*DagLeaf
+	Root       string
+	Leafs      map[string]*DagLeaf
+	Signatures []RootSignature `cbor:",omitempty" json:",omitempty"`
+}
+
+type SignatureType string
+
+const (
+	Ed25519SignatureType SignatureType = "ed25519"
+	SchnorrSignatureType SignatureType = "schnorr"
+)
+
+// Detached signature over the root leaf CID, kept next to the leaves so the root CID is unchanged
+type RootSignature struct {
+	Type      SignatureType
+	PublicKey []byte
+	Signature []byte
+}
+
+type Signer interface {
+	Type() SignatureType
+	PublicKey() []byte
+	Sign(message []byte) ([]byte, error)
 }
 
 type DagBuilder struct {
 	Leafs map[string]*DagLeaf
+
+	// Real paths of the directories being processed, used to detect loops when following symlinks
+	directories map[string]bool
+	cache       *statCacheState
+	hashes      *hashPool
+
+	// Set when the root directory holds the manifest of an extraction, which is not part of the dag
+	skipManifest bool
 }
 
 type DagLeaf struct {
@@ -36,14 +95,51 @@ type DagLeaf struct {
 	Links             map[string]string
 	ParentHash        string
 	AdditionalData    map[string]string
+	MerkleHashScheme  merkletree.TypeHashScheme `cbor:",omitempty" json:",omitempty"`
+	Metadata          *FileMetadata             `cbor:",omitempty" json:",omitempty"`
 }
 
 type DagLeafBuilder struct {
-	ItemName string
-	Label    int64
-	LeafType LeafType
-	Data     []byte
-	Links    map[string]string
+	ItemName         string
+	Label            int64
+	LeafType         LeafType
+	Data             []byte
+	Links            map[string]string
+	MerkleHashScheme merkletree.TypeHashScheme
+	Metadata         *FileMetadata
+
+	// Content hash of Data when it is already known
+	contentHash []byte
+	// Lowest LatestLabel of a root leaf, labels issued by earlier revisions stay taken
+	latestLabel int64
+}
+
+// Selects which fields of FileMetadata are recorded when building a dag from disk
+type MetadataFields uint8
+
+const (
+	ModeMetadata MetadataFields = 1 << iota
+	OwnerMetadata
+	ModTimeMetadata
+	// Extended attributes, which include POSIX ACLs and SELinux labels, only supported on Linux
+	XattrMetadata
+
+	PosixMetadata = ModeMetadata | OwnerMetadata | ModTimeMetadata
+)
+
+// POSIX metadata of a file or directory, fields that were not recorded are nil and left out of the leaf hash
+type FileMetadata struct {
+	Mode    *uint32             `cbor:",omitempty" json:",omitempty"`
+	Uid     *uint32             `cbor:",omitempty" json:",omitempty"`
+	Gid     *uint32             `cbor:",omitempty" json:",omitempty"`
+	ModTime *int64              `cbor:",omitempty" json:",omitempty"` // Unix nanoseconds
+	Xattrs  []ExtendedAttribute `cbor:",omitempty" json:",omitempty"`
+}
+
+// Kept in a slice sorted by name so the leaf hash does not depend on map order
+type ExtendedAttribute struct {
+	Name  string
+	Value []byte
 }
 
 type ClassicTreeBranch struct {
@@ -51,10 +147,45 @@ type ClassicTreeBranch struct {
 	Proof *merkletree.Proof
 }
 
+type ClassicTreeRangeBranch struct {
+	Leaves []string
+	Proof  *merkletree.RangeProof
+}
+
+// Deleted holds the CIDs, or the paths relative to the previous root, removed in a revision
 type MetaData struct {
 	Deleted []string
 }
 
+// Root leaf of a revision without its links, the deletions it commits and the signatures over it
+type DeletionManifest struct {
+	Root         string
+	PreviousRoot string
+	MetaData
+	RootLeaf   *DagLeaf
+	Signatures []RootSignature `cbor:",omitempty" json:",omitempty"`
+}
+
 func SetChunkSize(size int) {
 	ChunkSize = size
 }
+
+func SetMerkleHashScheme(scheme merkletree.TypeHashScheme) {
+	MerkleHashScheme = scheme
+}
+
+func SetSymlinkHandling(mode SymlinkMode) {
+	SymlinkHandling = mode
+}
+
+func SetConcurrency(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	Concurrency = workers
+}
+
+func SetRecordedMetadata(fields MetadataFields) {
+	RecordedMetadata = fields
+}
@@ -0,0 +1,83 @@
+package dag
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Every attribute the user can read, POSIX ACLs are the system.posix_acl_access and
+// system.posix_acl_default attributes
+func readXattrs(path string) ([]ExtendedAttribute, error) {
+	list, err := getXattrBuffer(func(buf []byte) (int, error) {
+		return syscall.Listxattr(path, buf)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list extended attributes of %s: %w", path, err)
+	}
+
+	names := []string{}
+	for _, name := range strings.Split(string(list), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := make([]ExtendedAttribute, 0, len(names))
+	for _, name := range names {
+		value, err := getXattrBuffer(func(buf []byte) (int, error) {
+			return syscall.Getxattr(path, name, buf)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not read extended attribute %s of %s: %w", name, path, err)
+		}
+
+		result = append(result, ExtendedAttribute{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	return result, nil
+}
+
+func writeXattrs(path string, xattrs []ExtendedAttribute) error {
+	for _, xattr := range xattrs {
+		err := syscall.Setxattr(path, xattr.Name, xattr.Value, 0)
+		if err != nil {
+			return fmt.Errorf("could not set extended attribute %s of %s: %w", xattr.Name, path, err)
+		}
+	}
+
+	return nil
+}
+
+// Asks for the size first and retries when the attributes grow in between
+func getXattrBuffer(get func(buf []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if size == 0 {
+			return []byte{}, nil
+		}
+
+		buf := make([]byte, size)
+
+		size, err = get(buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return buf[:size], nil
+	}
+}
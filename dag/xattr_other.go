@@ -0,0 +1,15 @@
+//go:build !linux
+
+package dag
+
+import (
+	"fmt"
+)
+
+func readXattrs(path string) ([]ExtendedAttribute, error) {
+	return nil, fmt.Errorf("extended attributes are not supported on this platform")
+}
+
+func writeXattrs(path string, xattrs []ExtendedAttribute) error {
+	return fmt.Errorf("extended attributes are not supported on this platform")
+}
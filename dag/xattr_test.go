@@ -0,0 +1,133 @@
+package dag
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExtendedAttributes(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{"file.txt": "content"})
+	file := filepath.Join(input, "file.txt")
+
+	xattrs := []ExtendedAttribute{
+		{Name: "user.checksum", Value: []byte("abc")},
+		{Name: "user.empty", Value: []byte{}},
+	}
+
+	err := writeXattrs(file, xattrs)
+	if err != nil {
+		t.Skipf("Extended attributes are not supported here: %s", err)
+	}
+
+	SetRecordedMetadata(XattrMetadata)
+	defer SetRecordedMetadata(0)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	leaf, err := dag.leafAtPath("file.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if leaf.Metadata == nil || len(leaf.Metadata.Xattrs) != 2 || leaf.Metadata.Xattrs[0].Name != "user.checksum" {
+		t.Fatalf("Unexpected extended attributes %v", leaf.Metadata)
+	}
+
+	tampered := leaf.Clone()
+	tampered.Metadata = &FileMetadata{Xattrs: []ExtendedAttribute{{Name: "user.checksum", Value: []byte("abd")}}}
+	if tampered.VerifyLeaf() == nil {
+		t.Fatal("Leaf with tampered extended attributes verified")
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.CreateDirectory(output)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	restored, err := readXattrs(filepath.Join(output, "file.txt"))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if len(restored) != 2 || restored[0].Name != "user.checksum" || string(restored[0].Value) != "abc" {
+		t.Fatalf("Extended attributes were not restored: %v", restored)
+	}
+}
+
+func TestRestoredXattrNamespaces(t *testing.T) {
+	tmpDir, input := createTestInput(t, map[string]string{"file.txt": "content"})
+	file := filepath.Join(input, "file.txt")
+
+	err := writeXattrs(file, []ExtendedAttribute{
+		{Name: "user.checksum", Value: []byte("abc")},
+		{Name: "security.label", Value: []byte("untrusted")},
+	})
+	if err != nil {
+		t.Skipf("Security extended attributes are not supported here: %s", err)
+	}
+
+	SetRecordedMetadata(XattrMetadata)
+	defer SetRecordedMetadata(0)
+
+	dag, err := CreateDag(input, false)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	leaf, err := dag.leafAtPath("file.txt")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	recorded := map[string]bool{}
+	for _, xattr := range leaf.Metadata.Xattrs {
+		recorded[xattr.Name] = true
+	}
+
+	if !recorded["security.label"] {
+		t.Fatalf("Security extended attribute was not recorded: %v", leaf.Metadata.Xattrs)
+	}
+
+	names := func(path string) map[string]bool {
+		restored, err := readXattrs(path)
+		if err != nil {
+			t.Fatalf("Error: %s", err)
+		}
+
+		result := map[string]bool{}
+		for _, xattr := range restored {
+			result[xattr.Name] = true
+		}
+
+		return result
+	}
+
+	output := filepath.Join(tmpDir, "output")
+	err = dag.Extract(output, nil)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	restored := names(filepath.Join(output, "file.txt"))
+	if restored["security.label"] {
+		t.Fatal("Security extended attribute from the dag was restored by default")
+	}
+
+	if !restored["user.checksum"] {
+		t.Fatal("User extended attribute was not restored")
+	}
+
+	output = filepath.Join(tmpDir, "all")
+	err = dag.Extract(output, &ExtractOptions{AllXattrs: true})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	if !names(filepath.Join(output, "file.txt"))["security.label"] {
+		t.Fatal("Security extended attribute was not restored with AllXattrs")
+	}
+}
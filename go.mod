@@ -3,20 +3,24 @@ module github.com/HORNET-Storage/scionic-merkletree
 go 1.19
 
 require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.2
 	github.com/fxamacker/cbor/v2 v2.4.0
+	github.com/ipfs/go-cid v0.4.1
+	github.com/multiformats/go-multicodec v0.9.0
+	github.com/multiformats/go-multihash v0.0.15
 	github.com/txaty/gool v0.1.5
+	golang.org/x/crypto v0.1.0
 )
 
 require (
-	github.com/ipfs/go-cid v0.4.1 // indirect
+	github.com/btcsuite/btcd/chaincfg/chainhash v1.0.1 // indirect
+	github.com/decred/dcrd/crypto/blake256 v1.0.0 // indirect
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1 // indirect
 	github.com/klauspost/cpuid/v2 v2.0.4 // indirect
 	github.com/minio/blake2b-simd v0.0.0-20160723061019-3f5f724cb5b1 // indirect
 	github.com/minio/sha256-simd v1.0.0 // indirect
-	github.com/multiformats/go-multicodec v0.9.0 // indirect
-	github.com/multiformats/go-multihash v0.0.15 // indirect
 	github.com/multiformats/go-varint v0.0.6 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
-	golang.org/x/crypto v0.1.0 // indirect
 	golang.org/x/sys v0.1.0 // indirect
 )
 
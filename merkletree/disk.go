@@ -0,0 +1,258 @@
+package merkletree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrNodeSizeMismatch is the error for leaves of different sizes in a disk-backed tree,
+// which stores every node in a fixed size slot.
+var ErrNodeSizeMismatch = errors.New("all leaves of a disk-backed tree must have the same size")
+
+// diskBufferSize is the size of the buffers used to stream levels to and from the node file.
+const diskBufferSize = 1 << 20
+
+// DiskTree is a binary Merkle Tree whose node levels are kept in a temporary file instead of memory.
+// It is built by streaming the data blocks from an iterator, and it serves proofs by reading the
+// O(log n) sibling nodes from the file. Its root and proofs are the same as the ones of a MerkleTree
+// built from the same data blocks in the same order.
+type DiskTree struct {
+	Config
+	// concatHashFunc is the function for concatenating two hashes, see MerkleTree.
+	concatHashFunc typeConcatHashFunc
+	// file holds the levels one after the other, each node in a slot of nodeSize bytes.
+	file *os.File
+	// nodeSize is the size of every node in the file.
+	nodeSize int
+	// levelOffsets are the offsets of the levels in the file, level 0 holding the leaves.
+	levelOffsets []int64
+	// Root is the hash of the Merkle root node.
+	Root []byte
+	// Depth is the depth of the Merkle Tree.
+	Depth int
+	// NumLeaves is the number of leaves in the Merkle Tree.
+	NumLeaves int
+}
+
+// NewDiskTree builds a disk-backed Merkle Tree from the data blocks yielded by the iterator,
+// storing its levels in a new temporary file in dir. If dir is empty, the default directory for
+// temporary files is used. The tree must be closed to remove the file.
+// Only binary trees are supported and the nodes are computed without parallelization,
+// the Mode, RunInParallel and NumRoutines settings are ignored.
+func NewDiskTree(config *Config, dir string, blocks TypeDataBlockIterator) (*DiskTree, error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if !config.HashScheme.valid() {
+		return nil, ErrInvalidHashScheme
+	}
+	if config.Arity < 0 || config.Arity == 1 {
+		return nil, ErrInvalidArity
+	}
+	if config.isKary() {
+		return nil, ErrArityUnsupported
+	}
+
+	t := &DiskTree{Config: *config}
+	if t.HashFunc == nil {
+		t.HashFunc = DefaultHashFunc
+	}
+	t.concatHashFunc = concatHashFuncFor(&t.Config)
+
+	var err error
+	if t.file, err = os.CreateTemp(dir, "merkletree-*.nodes"); err != nil {
+		return nil, err
+	}
+
+	if err = t.writeLeaves(blocks); err == nil {
+		if t.NumLeaves <= 1 {
+			err = ErrInvalidNumOfDataBlocks
+		} else {
+			err = t.buildLevels()
+		}
+	}
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// writeLeaves streams the leaves of the data blocks into level 0 of the file.
+func (t *DiskTree) writeLeaves(blocks TypeDataBlockIterator) (err error) {
+	w := bufio.NewWriterSize(t.file, diskBufferSize)
+	var last []byte
+	blocks(func(block DataBlock) bool {
+		if block == nil {
+			err = ErrDataBlockIsNil
+			return false
+		}
+		var leaf []byte
+		if leaf, err = dataBlockToLeaf(block, &t.Config); err != nil {
+			return false
+		}
+		if t.NumLeaves == 0 {
+			t.nodeSize = len(leaf)
+		} else if len(leaf) != t.nodeSize {
+			err = ErrNodeSizeMismatch
+			return false
+		}
+		if _, err = w.Write(leaf); err != nil {
+			return false
+		}
+		last = leaf
+		t.NumLeaves++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// Pad an odd level by repeating its last node, as fixOddLength does.
+	if t.NumLeaves&1 == 1 {
+		if _, err = w.Write(last); err != nil {
+			return err
+		}
+	}
+	t.levelOffsets = []int64{0}
+	return w.Flush()
+}
+
+// buildLevels computes every level from the one below it, streaming it from the file
+// and appending the new level at the end of the file, and then the root.
+func (t *DiskTree) buildLevels() error {
+	var (
+		count  = t.NumLeaves
+		offset = int64((count + count&1) * t.nodeSize)
+		left   = make([]byte, t.nodeSize)
+		right  = make([]byte, t.nodeSize)
+	)
+	for {
+		length := count + count&1
+		r := bufio.NewReaderSize(io.NewSectionReader(t.file, t.levelOffsets[len(t.levelOffsets)-1], int64(length*t.nodeSize)), diskBufferSize)
+
+		// The top level has a single pair, the hash of which is the root.
+		if length == 2 {
+			if _, err := io.ReadFull(r, left); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(r, right); err != nil {
+				return err
+			}
+			root, err := t.HashFunc(t.concatHashFunc(left, right))
+			if err != nil {
+				return err
+			}
+			t.Root = root
+			t.Depth = len(t.levelOffsets)
+			return nil
+		}
+
+		w := bufio.NewWriterSize(t.file, diskBufferSize)
+		var parent []byte
+		for i := 0; i < length; i += 2 {
+			if _, err := io.ReadFull(r, left); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(r, right); err != nil {
+				return err
+			}
+			var err error
+			if parent, err = t.HashFunc(t.concatHashFunc(left, right)); err != nil {
+				return err
+			}
+			if len(parent) != t.nodeSize {
+				return ErrNodeSizeMismatch
+			}
+			if _, err = w.Write(parent); err != nil {
+				return err
+			}
+		}
+		count = length >> 1
+		if count&1 == 1 {
+			if _, err := w.Write(parent); err != nil {
+				return err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		t.levelOffsets = append(t.levelOffsets, offset)
+		offset += int64((count + count&1) * t.nodeSize)
+	}
+}
+
+// readNode reads the node at idx of the given level from the file.
+func (t *DiskTree) readNode(level, idx int) ([]byte, error) {
+	node := make([]byte, t.nodeSize)
+	if _, err := t.file.ReadAt(node, t.levelOffsets[level]+int64(idx*t.nodeSize)); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// Leaf returns the leaf at the given index.
+func (t *DiskTree) Leaf(idx int) ([]byte, error) {
+	if idx < 0 || idx >= t.NumLeaves {
+		return nil, ErrLeafIndexOutOfRange
+	}
+	return t.readNode(0, idx)
+}
+
+// Proof generates the Merkle proof for the leaf at the given index by reading one sibling per level from the file.
+func (t *DiskTree) Proof(idx int) (*Proof, error) {
+	if idx < 0 || idx >= t.NumLeaves {
+		return nil, ErrLeafIndexOutOfRange
+	}
+	proof := &Proof{
+		Siblings: make([][]byte, t.Depth),
+	}
+	for i := 0; i < t.Depth; i++ {
+		sibling := idx ^ 1
+		if idx&1 == 0 {
+			proof.Path += 1 << i
+		}
+		node, err := t.readNode(i, sibling)
+		if err != nil {
+			return nil, err
+		}
+		proof.Siblings[i] = node
+		idx >>= 1
+	}
+	return proof, nil
+}
+
+// Verify checks if the data block is valid using the Merkle Tree proof and the Merkle root hash of the tree.
+func (t *DiskTree) Verify(dataBlock DataBlock, proof *Proof) error {
+	return Verify(dataBlock, proof, t.Root, &t.Config)
+}
+
+// Contains reports whether the leaf at the given index is the leaf of the data block.
+func (t *DiskTree) Contains(idx int, dataBlock DataBlock) (bool, error) {
+	leaf, err := t.Leaf(idx)
+	if err != nil {
+		return false, err
+	}
+	expected, err := dataBlockToLeaf(dataBlock, &t.Config)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(leaf, expected), nil
+}
+
+// Close closes and removes the file holding the tree levels.
+func (t *DiskTree) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	name := t.file.Name()
+	err := t.file.Close()
+	t.file = nil
+	if removeErr := os.Remove(name); err == nil {
+		err = removeErr
+	}
+	return err
+}
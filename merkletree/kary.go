@@ -0,0 +1,163 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+)
+
+var (
+	// ErrInvalidArity is the error for an arity that can not form a tree.
+	ErrInvalidArity = errors.New("arity must be 0 or at least 2")
+	// ErrArityUnsupported is the error for operations that are only available for binary trees.
+	ErrArityUnsupported = errors.New("operation is only supported for binary trees")
+)
+
+// isKary reports whether the configuration describes a tree with more than two children per node.
+func (c *Config) isKary() bool {
+	return c.Arity > 2
+}
+
+// concatNodes concatenates the children of a k-ary node according to the configuration.
+// With SortSiblingPairs the children are sorted before they are concatenated, and with HashSchemeRFC6962
+// the result starts with NodePrefix.
+func concatNodes(config *Config, nodes [][]byte) []byte {
+	if config.SortSiblingPairs {
+		sorted := make([][]byte, len(nodes))
+		copy(sorted, nodes)
+		sort.Slice(sorted, func(i, j int) bool {
+			return bytes.Compare(sorted[i], sorted[j]) < 0
+		})
+		nodes = sorted
+	}
+	size := 0
+	for _, node := range nodes {
+		size += len(node)
+	}
+	if config.HashScheme == HashSchemeRFC6962 {
+		size++
+	}
+	result := make([]byte, 0, size)
+	if config.HashScheme == HashSchemeRFC6962 {
+		result = append(result, NodePrefix)
+	}
+	for _, node := range nodes {
+		result = append(result, node...)
+	}
+	return result
+}
+
+// buildKary builds a tree with Arity children per node.
+// Every level whose length is not a multiple of Arity is padded by repeating its last node,
+// the same way binary levels are padded, and the root is the hash of the single node group of the top level.
+// Tree nodes are computed without parallelization, only the leaves are generated in parallel.
+func (m *MerkleTree) buildKary() (err error) {
+	if m.Mode != ModeProofGen && m.Mode != ModeTreeBuild && m.Mode != ModeProofGenAndTreeBuild {
+		return ErrInvalidConfigMode
+	}
+	if uint64(m.NumLeaves) > 1<<32-1 {
+		// The leaf index is stored in the 4 byte Path of the proofs.
+		return ErrInvalidNumOfDataBlocks
+	}
+
+	arity := m.Arity
+	level := make([][]byte, m.NumLeaves)
+	copy(level, m.Leaves)
+	m.nodes = nil
+	m.Depth = 0
+	for len(level) > 1 {
+		for len(level)%arity != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		m.nodes = append(m.nodes, level)
+		parents := make([][]byte, len(level)/arity)
+		for i := range parents {
+			if parents[i], err = m.HashFunc(concatNodes(&m.Config, level[i*arity:(i+1)*arity])); err != nil {
+				return
+			}
+		}
+		level = parents
+		m.Depth++
+	}
+	m.Root = level[0]
+
+	if m.Mode == ModeProofGen || m.Mode == ModeProofGenAndTreeBuild {
+		m.Proofs = make([]*Proof, m.NumLeaves)
+		for i := range m.Proofs {
+			m.Proofs[i] = m.karyProofAt(i)
+		}
+	}
+
+	if m.Mode == ModeProofGen {
+		// The tree structure is only cached when it is built.
+		m.nodes = nil
+		return
+	}
+
+	m.leafMap = make(map[string]int)
+	for i := 0; i < m.NumLeaves; i++ {
+		m.leafMap[string(m.Leaves[i])] = i
+	}
+	return
+}
+
+// karyProofAt computes the proof for the leaf at idx in a tree with Arity children per node.
+// Path holds the leaf index, the position of the proven node among its siblings at level i being
+// (Path / Arity^i) % Arity. Siblings holds Arity-1 nodes per level, in order, without the proven node.
+func (m *MerkleTree) karyProofAt(idx int) *Proof {
+	arity := m.Arity
+	proof := &Proof{
+		Path:     uint32(idx),
+		Siblings: make([][]byte, 0, m.Depth*(arity-1)),
+	}
+	for i := 0; i < m.Depth; i++ {
+		first := idx - idx%arity
+		for j := first; j < first+arity; j++ {
+			if j != idx {
+				proof.Siblings = append(proof.Siblings, m.nodes[i][j])
+			}
+		}
+		idx /= arity
+	}
+	return proof
+}
+
+// karyDepth returns the number of levels below the root of a tree with n leaves and the given arity.
+func karyDepth(n, arity int) int {
+	depth := 0
+	for n > 1 {
+		n = (n + arity - 1) / arity
+		depth++
+	}
+	return depth
+}
+
+// verifyKary recomputes the root of a tree with Arity children per node from the leaf and its proof.
+func verifyKary(leaf []byte, proof *Proof, config *Config) ([]byte, error) {
+	groupSize := config.Arity - 1
+	if len(proof.Siblings)%groupSize != 0 {
+		return nil, errors.New("verification failed")
+	}
+
+	var (
+		result = leaf
+		idx    = int(proof.Path)
+		err    error
+	)
+	for i := 0; i < len(proof.Siblings); i += groupSize {
+		pos := idx % config.Arity
+		nodes := make([][]byte, 0, config.Arity)
+		nodes = append(nodes, proof.Siblings[i:i+pos]...)
+		nodes = append(nodes, result)
+		nodes = append(nodes, proof.Siblings[i+pos:i+groupSize]...)
+		if result, err = config.HashFunc(concatNodes(config, nodes)); err != nil {
+			return nil, err
+		}
+		idx /= config.Arity
+	}
+	if idx != 0 {
+		// The leaf index points outside of a tree of this depth.
+		return nil, errors.New("verification failed")
+	}
+	return result, nil
+}
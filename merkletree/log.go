@@ -0,0 +1,347 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+	"sync"
+)
+
+var (
+	// ErrLogIndexOutOfRange is the error for a leaf index or tree size beyond the current size of the log.
+	ErrLogIndexOutOfRange = errors.New("index is out of range of the log")
+	// ErrInclusionProofInvalid is the error for an inclusion proof that does not lead to the expected root.
+	ErrInclusionProofInvalid = errors.New("inclusion proof verification failed")
+	// ErrConsistencyProofInvalid is the error for a consistency proof that does not lead to the expected roots.
+	ErrConsistencyProofInvalid = errors.New("consistency proof verification failed")
+)
+
+// Log is an append-only Merkle log compatible with the Merkle Tree Hash of RFC 6962.
+// Leaves are hashed with LeafPrefix and interior nodes with NodePrefix, and the tree is split
+// at the largest power of two instead of duplicating odd nodes, so every earlier tree size is a
+// prefix of the current one and can be proven consistent with it.
+type Log struct {
+	// hashFunc is the hash function of the log, SHA256 by default.
+	hashFunc TypeHashFunc
+	// leaves are the leaf hashes in the order they were appended.
+	leaves [][]byte
+	// subtrees caches the hashes of complete subtrees, which never change once all their leaves are appended.
+	subtrees map[logSubtree][]byte
+	// mu protects leaves and subtrees.
+	mu sync.Mutex
+}
+
+// logSubtree identifies a subtree of the log by its first leaf and its number of leaves.
+type logSubtree struct {
+	start uint64
+	size  uint64
+}
+
+// NewLog creates an empty log using the provided hash function.
+// If hashFunc is nil, SHA256 is used.
+func NewLog(hashFunc TypeHashFunc) *Log {
+	if hashFunc == nil {
+		// The log can be read and appended from several goroutines, so use the concurrent safe hash function.
+		hashFunc = DefaultHashFuncParallel
+	}
+	return &Log{
+		hashFunc: hashFunc,
+		subtrees: make(map[logSubtree][]byte),
+	}
+}
+
+// Append adds the data block to the end of the log and returns its index.
+func (l *Log) Append(block DataBlock) (uint64, error) {
+	if block == nil {
+		return 0, ErrDataBlockIsNil
+	}
+	leaf, err := logLeafHash(block, l.hashFunc)
+	if err != nil {
+		return 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.leaves = append(l.leaves, leaf)
+	return uint64(len(l.leaves) - 1), nil
+}
+
+// Size returns the number of leaves in the log.
+func (l *Log) Size() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return uint64(len(l.leaves))
+}
+
+// LeafHash returns the hash of the leaf at the given index.
+func (l *Log) LeafHash(index uint64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index >= uint64(len(l.leaves)) {
+		return nil, ErrLogIndexOutOfRange
+	}
+	return l.leaves[index], nil
+}
+
+// Root returns the Merkle Tree Hash of the whole log.
+func (l *Log) Root() ([]byte, error) {
+	return l.RootAt(l.Size())
+}
+
+// RootAt returns the Merkle Tree Hash of the first size leaves of the log.
+func (l *Log) RootAt(size uint64) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.leaves)) {
+		return nil, ErrLogIndexOutOfRange
+	}
+	if size == 0 {
+		return l.hashFunc(nil)
+	}
+	return l.subtreeHash(0, size)
+}
+
+// InclusionProof returns the audit path proving that the leaf at index is part of the tree of the given size.
+func (l *Log) InclusionProof(index, size uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if size > uint64(len(l.leaves)) || index >= size {
+		return nil, ErrLogIndexOutOfRange
+	}
+	return l.inclusionPath(index, 0, size)
+}
+
+// ConsistencyProof returns the proof that the tree of size first is a prefix of the tree of size second.
+func (l *Log) ConsistencyProof(first, second uint64) ([][]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if second > uint64(len(l.leaves)) || first == 0 || first > second {
+		return nil, ErrLogIndexOutOfRange
+	}
+	return l.consistencyPath(first, 0, second, true)
+}
+
+// subtreeHash computes the Merkle Tree Hash of the size leaves starting at start.
+// The caller must hold the lock.
+func (l *Log) subtreeHash(start, size uint64) ([]byte, error) {
+	if size == 1 {
+		return l.leaves[start], nil
+	}
+
+	// Only complete subtrees are cached, the hash of an incomplete one changes as leaves are appended.
+	complete := size&(size-1) == 0
+	key := logSubtree{start: start, size: size}
+	if complete {
+		if hash, ok := l.subtrees[key]; ok {
+			return hash, nil
+		}
+	}
+
+	split := largestPowerOfTwoBelow(size)
+	left, err := l.subtreeHash(start, split)
+	if err != nil {
+		return nil, err
+	}
+	right, err := l.subtreeHash(start+split, size-split)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := l.hashFunc(concatNodeHash(left, right))
+	if err != nil {
+		return nil, err
+	}
+
+	if complete {
+		l.subtrees[key] = hash
+	}
+	return hash, nil
+}
+
+// inclusionPath computes PATH(index, D[start:start+size]) as defined in RFC 6962.
+// The caller must hold the lock.
+func (l *Log) inclusionPath(index, start, size uint64) ([][]byte, error) {
+	if size == 1 {
+		return nil, nil
+	}
+	split := largestPowerOfTwoBelow(size)
+	if index < split {
+		path, err := l.inclusionPath(index, start, split)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err := l.subtreeHash(start+split, size-split)
+		if err != nil {
+			return nil, err
+		}
+		return append(path, sibling), nil
+	}
+	path, err := l.inclusionPath(index-split, start+split, size-split)
+	if err != nil {
+		return nil, err
+	}
+	sibling, err := l.subtreeHash(start, split)
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sibling), nil
+}
+
+// consistencyPath computes SUBPROOF(first, D[start:start+size], complete) as defined in RFC 6962.
+// The caller must hold the lock.
+func (l *Log) consistencyPath(first, start, size uint64, complete bool) ([][]byte, error) {
+	if first == size {
+		if complete {
+			return nil, nil
+		}
+		hash, err := l.subtreeHash(start, size)
+		if err != nil {
+			return nil, err
+		}
+		return [][]byte{hash}, nil
+	}
+	split := largestPowerOfTwoBelow(size)
+	if first <= split {
+		path, err := l.consistencyPath(first, start, split, complete)
+		if err != nil {
+			return nil, err
+		}
+		sibling, err := l.subtreeHash(start+split, size-split)
+		if err != nil {
+			return nil, err
+		}
+		return append(path, sibling), nil
+	}
+	path, err := l.consistencyPath(first-split, start+split, size-split, false)
+	if err != nil {
+		return nil, err
+	}
+	sibling, err := l.subtreeHash(start, split)
+	if err != nil {
+		return nil, err
+	}
+	return append(path, sibling), nil
+}
+
+// VerifyInclusion checks that the data block is the leaf at index of the log tree of the given size,
+// using the audit path and the Merkle Tree Hash of that tree.
+// If hashFunc is nil, SHA256 is used.
+func VerifyInclusion(block DataBlock, index, size uint64, proof [][]byte, root []byte, hashFunc TypeHashFunc) error {
+	if block == nil {
+		return ErrDataBlockIsNil
+	}
+	if index >= size {
+		return ErrLogIndexOutOfRange
+	}
+	if hashFunc == nil {
+		hashFunc = DefaultHashFunc
+	}
+
+	result, err := logLeafHash(block, hashFunc)
+	if err != nil {
+		return err
+	}
+
+	// Walk the audit path as described in RFC 9162, section 2.1.3.2.
+	fn, sn := index, size-1
+	for _, sibling := range proof {
+		if sn == 0 {
+			return ErrInclusionProofInvalid
+		}
+		if fn&1 == 1 || fn == sn {
+			if result, err = hashFunc(concatNodeHash(sibling, result)); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			if result, err = hashFunc(concatNodeHash(result, sibling)); err != nil {
+				return err
+			}
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(result, root) {
+		return ErrInclusionProofInvalid
+	}
+	return nil
+}
+
+// VerifyConsistency checks that the log tree of size first, with root firstRoot, is a prefix of the
+// log tree of size second, with root secondRoot.
+// If hashFunc is nil, SHA256 is used.
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot []byte, proof [][]byte, hashFunc TypeHashFunc) error {
+	if first == 0 || first > second {
+		return ErrLogIndexOutOfRange
+	}
+	if first == second {
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrConsistencyProofInvalid
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return ErrConsistencyProofInvalid
+	}
+	if hashFunc == nil {
+		hashFunc = DefaultHashFunc
+	}
+
+	// Walk the proof as described in RFC 9162, section 2.1.4.2.
+	// When the first tree is complete its root is the starting node and is not part of the proof.
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	var (
+		fr  = proof[0]
+		sr  = proof[0]
+		err error
+	)
+	for _, node := range proof[1:] {
+		if sn == 0 {
+			return ErrConsistencyProofInvalid
+		}
+		if fn&1 == 1 || fn == sn {
+			if fr, err = hashFunc(concatNodeHash(node, fr)); err != nil {
+				return err
+			}
+			if sr, err = hashFunc(concatNodeHash(node, sr)); err != nil {
+				return err
+			}
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			if sr, err = hashFunc(concatNodeHash(sr, node)); err != nil {
+				return err
+			}
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrConsistencyProofInvalid
+	}
+	return nil
+}
+
+// logLeafHash computes the RFC 6962 leaf hash of the data block.
+func logLeafHash(block DataBlock, hashFunc TypeHashFunc) ([]byte, error) {
+	return dataBlockToLeaf(block, &Config{HashFunc: hashFunc, HashScheme: HashSchemeRFC6962})
+}
+
+// largestPowerOfTwoBelow returns the largest power of two strictly smaller than n, for n > 1.
+func largestPowerOfTwoBelow(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
@@ -46,11 +46,28 @@ const (
 	ModeProofGenAndTreeBuild
 )
 
+const (
+	// HashSchemeLegacy hashes leaves and interior nodes the same way, without any prefix.
+	HashSchemeLegacy TypeHashScheme = iota
+	// HashSchemeRFC6962 prefixes leaves with LeafPrefix and interior nodes with NodePrefix before hashing,
+	// as described in RFC 6962, so that an interior node can never be passed off as a leaf.
+	HashSchemeRFC6962
+)
+
+const (
+	// LeafPrefix is the byte prepended to the data blocks before hashing them in HashSchemeRFC6962.
+	LeafPrefix byte = 0x00
+	// NodePrefix is the byte prepended to the concatenated children before hashing them in HashSchemeRFC6962.
+	NodePrefix byte = 0x01
+)
+
 var (
 	// ErrInvalidNumOfDataBlocks is the error for an invalid number of data blocks.
 	ErrInvalidNumOfDataBlocks = errors.New("the number of data blocks must be greater than 1")
 	// ErrInvalidConfigMode is the error for an invalid configuration mode.
 	ErrInvalidConfigMode = errors.New("invalid configuration mode")
+	// ErrInvalidHashScheme is the error for an invalid hash scheme.
+	ErrInvalidHashScheme = errors.New("invalid hash scheme")
 	// ErrProofIsNil is the error for a nil proof.
 	ErrProofIsNil = errors.New("proof is nil")
 	// ErrDataBlockIsNil is the error for a nil data block.
@@ -60,6 +77,8 @@ var (
 	ErrProofInvalidModeTreeNotBuilt = errors.New("merkle tree is not in built, could not generate proof by this method")
 	// ErrProofInvalidDataBlock is the error for an invalid data block in Proof() function.
 	ErrProofInvalidDataBlock = errors.New("data block is not a member of the merkle tree")
+	// ErrLeafIndexOutOfRange is the error for a leaf index outside of the Merkle Tree.
+	ErrLeafIndexOutOfRange = errors.New("leaf index is out of range")
 )
 
 // DataBlock is the interface for input data blocks used to generate the Merkle Tree.
@@ -84,6 +103,10 @@ type workerArgs struct {
 // TypeConfigMode is the type in the Merkle Tree configuration indicating what operations are performed.
 type TypeConfigMode int
 
+// TypeHashScheme is the type in the Merkle Tree configuration indicating how leaves and interior nodes
+// are domain-separated before hashing.
+type TypeHashScheme int
+
 // TypeHashFunc is the signature of the hash functions used for Merkle Tree generation.
 type TypeHashFunc func([]byte) ([]byte, error)
 
@@ -106,6 +129,14 @@ type Config struct {
 	SortSiblingPairs bool
 	// If true, the leaf nodes are NOT hashed before being added to the Merkle Tree.
 	DisableLeafHashing bool
+	// HashScheme selects how leaves and interior nodes are separated when hashing.
+	// The zero value is HashSchemeLegacy, which keeps the roots of existing trees unchanged.
+	// When DisableLeafHashing is true the leaves are used as they are and only the interior nodes are prefixed.
+	HashScheme TypeHashScheme
+	// Arity is the number of children of every interior node.
+	// The zero value builds a binary tree. With an arity above 2, proofs hold Arity-1 siblings per level
+	// and their Path holds the leaf index instead of a bitmask, and tree nodes are not computed in parallel.
+	Arity int
 }
 
 // MerkleTree implements the Merkle Tree data structure.
@@ -144,6 +175,8 @@ type MerkleTree struct {
 }
 
 // Proof represents a Merkle Tree proof.
+// Bit i of Path is set when the node on the path at level i is a left child, so Siblings[i] is hashed on its right,
+// and cleared when it is a right child, so Siblings[i] is hashed on its left. Level 0 is the leaf level.
 type Proof struct {
 	Siblings [][]byte // Sibling nodes to the Merkle Tree path of the data block.
 	Path     uint32   // Path variable indicating whether the neighbor is on the left or right.
@@ -170,36 +203,129 @@ func DefaultHashFuncParallel(data []byte) ([]byte, error) {
 	return digest.Sum(make([]byte, 0, digest.Size())), nil
 }
 
+// TypeDataBlockIterator is the signature of the iterators feeding data blocks to the tree builders.
+// The iterator calls yield for every data block in order and stops early when yield returns false.
+type TypeDataBlockIterator func(yield func(DataBlock) bool)
+
 // New generates a new Merkle Tree with the specified configuration and data blocks.
-func New(config *Config, blocks map[string]DataBlock) (m *MerkleTree, err error) {
+// The data blocks are ordered by their keys, which are kept in Keys.
+func New(config *Config, blocks map[string]DataBlock) (*MerkleTree, error) {
 	var keys []string
 	for k := range blocks {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 
-	// Step 2: Build a sorted slice from the map.
+	// Build a sorted slice from the map.
 	var sortedBlocks []DataBlock
 	for _, k := range keys {
 		sortedBlocks = append(sortedBlocks, blocks[k])
 	}
 
+	m, err := newTree(config, sortedBlocks)
+	if err != nil {
+		return nil, err
+	}
+	m.Keys = keys
+	return m, nil
+}
+
+// NewFromSlice generates a new Merkle Tree with the specified configuration and data blocks,
+// keeping the data blocks in the order of the slice. Keys is left empty.
+func NewFromSlice(config *Config, blocks []DataBlock) (*MerkleTree, error) {
+	return newTree(config, blocks)
+}
+
+// NewFromIterator generates a new Merkle Tree with the specified configuration and the data blocks
+// yielded by the iterator, keeping them in the order they are yielded. Keys is left empty.
+// Each data block is hashed into its leaf as it is yielded and is not retained, only the leaves
+// and the tree nodes are kept in memory, see NewDiskTree for trees too large for it.
+// The leaves are generated sequentially even when RunInParallel is set.
+func NewFromIterator(config *Config, blocks TypeDataBlockIterator) (*MerkleTree, error) {
+	m, err := initTree(config)
+	if err != nil {
+		return nil, err
+	}
+	blocks(func(block DataBlock) bool {
+		if block == nil {
+			err = ErrDataBlockIsNil
+			return false
+		}
+		var leaf []byte
+		if leaf, err = dataBlockToLeaf(block, &m.Config); err != nil {
+			return false
+		}
+		m.Leaves = append(m.Leaves, leaf)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(m.Leaves) <= 1 {
+		return nil, ErrInvalidNumOfDataBlocks
+	}
+	m.NumLeaves = len(m.Leaves)
+	m.Depth = bits.Len(uint(m.NumLeaves - 1))
+	if m.RunInParallel {
+		m.wp = gool.NewPool[workerArgs, error](m.NumRoutines, 0)
+		defer m.wp.Close()
+	}
+	if err = m.build(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// newTree builds the Merkle Tree of the data blocks in the given order.
+func newTree(config *Config, sortedBlocks []DataBlock) (m *MerkleTree, err error) {
 	// Check if there are enough data blocks to build the tree.
 	if len(sortedBlocks) <= 1 {
 		return nil, ErrInvalidNumOfDataBlocks
 	}
 
+	if m, err = initTree(config); err != nil {
+		return nil, err
+	}
+	m.NumLeaves = len(sortedBlocks)
+	m.Depth = bits.Len(uint(len(sortedBlocks) - 1))
+
+	if m.RunInParallel {
+		// Initialize a wait group for parallel computation and generate leaves.
+		// Task channel capacity is passed as 0, so use the default value: 2 * numWorkers.
+		m.wp = gool.NewPool[workerArgs, error](m.NumRoutines, 0)
+		defer m.wp.Close()
+		if m.Leaves, err = m.generateLeavesInParallel(sortedBlocks); err != nil {
+			return nil, err
+		}
+	} else {
+		// Generate leaves without parallelization.
+		if m.Leaves, err = m.generateLeaves(sortedBlocks); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = m.build(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// initTree validates the configuration and creates an empty Merkle Tree with it.
+func initTree(config *Config) (*MerkleTree, error) {
 	// Initialize the configuration if it is not provided.
 	if config == nil {
 		config = new(Config)
 	}
+	if !config.HashScheme.valid() {
+		return nil, ErrInvalidHashScheme
+	}
+	if config.Arity < 0 || config.Arity == 1 {
+		return nil, ErrInvalidArity
+	}
 
 	// Create a MerkleTree with the provided configuration.
-	m = &MerkleTree{
-		Config:    *config,
-		NumLeaves: len(blocks),
-		Depth:     bits.Len(uint(len(sortedBlocks) - 1)),
-		Keys:      keys,
+	m := &MerkleTree{
+		Config: *config,
 	}
 
 	// Initialize the hash function.
@@ -214,39 +340,31 @@ func New(config *Config, blocks map[string]DataBlock) (m *MerkleTree, err error)
 
 	// Hash concatenation function initialization.
 	if m.concatHashFunc == nil {
-		if m.SortSiblingPairs {
-			m.concatHashFunc = concatSortHash
-		} else {
-			m.concatHashFunc = concatHash
-		}
+		m.concatHashFunc = concatHashFuncFor(&m.Config)
 	}
 
-	// Configure parallelization settings.
-	if m.RunInParallel {
-		// Set NumRoutines to the number of CPU cores if not specified or invalid.
-		if m.NumRoutines <= 0 {
-			m.NumRoutines = runtime.NumCPU()
-		}
-		// Initialize a wait group for parallel computation and generate leaves.
-		// Task channel capacity is passed as 0, so use the default value: 2 * numWorkers.
-		m.wp = gool.NewPool[workerArgs, error](m.NumRoutines, 0)
-		defer m.wp.Close()
-		if m.Leaves, err = m.generateLeavesInParallel(sortedBlocks); err != nil {
-			return nil, err
-		}
-	} else {
-		// Generate leaves without parallelization.
-		if m.Leaves, err = m.generateLeaves(sortedBlocks); err != nil {
-			return nil, err
-		}
+	// Set NumRoutines to the number of CPU cores if not specified or invalid.
+	if m.RunInParallel && m.NumRoutines <= 0 {
+		m.NumRoutines = runtime.NumCPU()
 	}
 
+	return m, nil
+}
+
+// build builds the tree and generates the proofs from the leaves according to the configured mode.
+func (m *MerkleTree) build() (err error) {
 	// Perform actions based on the configured mode.
 	// Set the mode to ModeProofGen by default if not specified.
 	if m.Mode == 0 {
 		m.Mode = ModeProofGen
 	}
 
+	// Trees with more than two children per node have their own construction.
+	if m.isKary() {
+		err = m.buildKary()
+		return
+	}
+
 	// Generate proofs in ModeProofGen.
 	if m.Mode == ModeProofGen {
 		err = m.generateProofs()
@@ -280,7 +398,7 @@ func New(config *Config, blocks map[string]DataBlock) (m *MerkleTree, err error)
 	}
 
 	// Return an error if the configuration mode is invalid.
-	return nil, ErrInvalidConfigMode
+	return ErrInvalidConfigMode
 }
 
 // Retrieve the index for the given key in the stored sorted key array
@@ -293,7 +411,26 @@ func (t *MerkleTree) GetIndexForKey(key string) (int, bool) {
 	return -1, false
 }
 
-// concatSortHash concatenates two byte slices, b1 and b2, in a sorted order.
+// valid reports whether the hash scheme is one of the known schemes.
+func (s TypeHashScheme) valid() bool {
+	return s == HashSchemeLegacy || s == HashSchemeRFC6962
+}
+
+// concatHashFuncFor returns the function used to concatenate sibling pairs for the given configuration.
+func concatHashFuncFor(config *Config) typeConcatHashFunc {
+	if config.HashScheme == HashSchemeRFC6962 {
+		if config.SortSiblingPairs {
+			return concatSortNodeHash
+		}
+		return concatNodeHash
+	}
+	if config.SortSiblingPairs {
+		return concatSortHash
+	}
+	return concatHash
+}
+
+// concatHash concatenates two byte slices, b1 and b2.
 func concatHash(b1 []byte, b2 []byte) []byte {
 	result := make([]byte, len(b1)+len(b2))
 	copy(result, b1)
@@ -312,6 +449,24 @@ func concatSortHash(b1 []byte, b2 []byte) []byte {
 	return concatHash(b2, b1)
 }
 
+// concatNodeHash concatenates two byte slices, b1 and b2, behind the RFC 6962 interior node prefix.
+func concatNodeHash(b1 []byte, b2 []byte) []byte {
+	result := make([]byte, 1+len(b1)+len(b2))
+	result[0] = NodePrefix
+	copy(result[1:], b1)
+	copy(result[1+len(b1):], b2)
+	return result
+}
+
+// concatSortNodeHash concatenates two byte slices, b1 and b2, in a sorted order
+// behind the RFC 6962 interior node prefix.
+func concatSortNodeHash(b1 []byte, b2 []byte) []byte {
+	if bytes.Compare(b1, b2) < 0 {
+		return concatNodeHash(b1, b2)
+	}
+	return concatNodeHash(b2, b1)
+}
+
 // initProofs initializes the MerkleTree's Proofs with the appropriate size and depth.
 func (m *MerkleTree) initProofs() {
 	m.Proofs = make([]*Proof, m.NumLeaves)
@@ -568,6 +723,12 @@ func dataBlockToLeaf(block DataBlock, config *Config) ([]byte, error) {
 		copy(leaf, blockBytes)
 		return leaf, nil
 	}
+	if config.HashScheme == HashSchemeRFC6962 {
+		prefixed := make([]byte, 1+len(blockBytes))
+		prefixed[0] = LeafPrefix
+		copy(prefixed[1:], blockBytes)
+		return config.HashFunc(prefixed)
+	}
 	return config.HashFunc(blockBytes)
 }
 
@@ -758,12 +919,12 @@ func Verify(dataBlock DataBlock, proof *Proof, root []byte, config *Config) erro
 	if config.HashFunc == nil {
 		config.HashFunc = DefaultHashFunc
 	}
+	if !config.HashScheme.valid() {
+		return ErrInvalidHashScheme
+	}
 
 	// Determine the concatenation function based on the configuration.
-	concatFunc := concatHash
-	if config.SortSiblingPairs {
-		concatFunc = concatSortHash
-	}
+	concatFunc := concatHashFuncFor(config)
 
 	// Convert the data block to a leaf.
 	leaf, err := dataBlockToLeaf(dataBlock, config)
@@ -771,6 +932,18 @@ func Verify(dataBlock DataBlock, proof *Proof, root []byte, config *Config) erro
 		return err
 	}
 
+	// Trees with more than two children per node carry the leaf index instead of a path bitmask.
+	if config.isKary() {
+		result, err := verifyKary(leaf, proof, config)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(result, root) {
+			return fmt.Errorf("verification failed")
+		}
+		return nil
+	}
+
 	// Traverse the Merkle proof and compute the resulting hash.
 	// Copy the slice so that the original leaf won't be modified.
 	result := make([]byte, len(leaf))
@@ -818,8 +991,27 @@ func (m *MerkleTree) Proof(dataBlock DataBlock) (*Proof, error) {
 	if !ok {
 		return nil, ErrProofInvalidDataBlock
 	}
+	return m.proofAt(idx), nil
+}
+
+// ProofAt generates the Merkle proof for the data block at the given index using the previously generated
+// Merkle Tree structure. Like Proof, it is only available when the configuration mode is ModeTreeBuild or
+// ModeProofGenAndTreeBuild.
+func (m *MerkleTree) ProofAt(idx int) (*Proof, error) {
+	if m.Mode != ModeTreeBuild && m.Mode != ModeProofGenAndTreeBuild {
+		return nil, ErrProofInvalidModeTreeNotBuilt
+	}
+	if idx < 0 || idx >= m.NumLeaves {
+		return nil, ErrLeafIndexOutOfRange
+	}
+	return m.proofAt(idx), nil
+}
 
-	// Compute the path and siblings for the proof.
+// proofAt computes the path and siblings of the proof for the leaf at idx from the tree nodes.
+func (m *MerkleTree) proofAt(idx int) *Proof {
+	if m.isKary() {
+		return m.karyProofAt(idx)
+	}
 	var (
 		path     uint32
 		siblings = make([][]byte, m.Depth)
@@ -836,5 +1028,5 @@ func (m *MerkleTree) Proof(dataBlock DataBlock) (*Proof, error) {
 	return &Proof{
 		Path:     path,
 		Siblings: siblings,
-	}, nil
+	}
 }
@@ -0,0 +1,717 @@
+package merkletree
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type testBlock struct {
+	data []byte
+}
+
+func (b *testBlock) Serialize() ([]byte, error) {
+	return b.data, nil
+}
+
+func createTestBlocks(count int) map[string]DataBlock {
+	blocks := map[string]DataBlock{}
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("%04d", i)
+		blocks[key] = &testBlock{data: []byte("block " + key)}
+	}
+	return blocks
+}
+
+func sortedTestBlocks(tree *MerkleTree, blocks map[string]DataBlock) []DataBlock {
+	result := make([]DataBlock, 0, len(tree.Keys))
+	for _, key := range tree.Keys {
+		result = append(result, blocks[key])
+	}
+	return result
+}
+
+func TestRangeProof(t *testing.T) {
+	for _, count := range []int{2, 3, 5, 8, 13} {
+		blocks := createTestBlocks(count)
+
+		tree, err := New(nil, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		sorted := sortedTestBlocks(tree, blocks)
+
+		for start := 0; start < count; start++ {
+			for end := start + 1; end <= count; end++ {
+				proof, err := tree.RangeProof(start, end)
+				if err != nil {
+					t.Fatalf("Could not generate range proof [%d, %d) of %d: %s", start, end, count, err)
+				}
+
+				err = VerifyRange(sorted[start:end], proof, tree.Root, nil)
+				if err != nil {
+					t.Fatalf("Range proof [%d, %d) of %d failed to verify: %s", start, end, count, err)
+				}
+
+				if end-start > 1 {
+					// Withholding the last block of the span must be detected
+					withheld := *proof
+					withheld.End--
+					err = VerifyRange(sorted[start:end-1], &withheld, tree.Root, nil)
+					if err == nil {
+						t.Fatalf("Range proof [%d, %d) of %d verified with a missing block", start, end, count)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestHashSchemeRFC6962(t *testing.T) {
+	blocks := createTestBlocks(6)
+
+	legacyTree, err := New(&Config{Mode: ModeProofGenAndTreeBuild}, blocks)
+	if err != nil {
+		t.Fatalf("Could not build tree: %s", err)
+	}
+
+	tree, err := New(&Config{HashScheme: HashSchemeRFC6962, Mode: ModeProofGenAndTreeBuild}, blocks)
+	if err != nil {
+		t.Fatalf("Could not build tree: %s", err)
+	}
+
+	if string(tree.Root) == string(legacyTree.Root) {
+		t.Fatal("RFC 6962 tree has the same root as the legacy tree")
+	}
+
+	sorted := sortedTestBlocks(tree, blocks)
+	for i, block := range sorted {
+		err = Verify(block, tree.Proofs[i], tree.Root, &Config{HashScheme: HashSchemeRFC6962})
+		if err != nil {
+			t.Fatalf("Proof %d failed to verify: %s", i, err)
+		}
+
+		err = Verify(block, legacyTree.Proofs[i], legacyTree.Root, nil)
+		if err != nil {
+			t.Fatalf("Legacy proof %d failed to verify: %s", i, err)
+		}
+	}
+
+	// Present the first interior node as a leaf, using the upper part of the first proof
+	secondPreimage := func(tree *MerkleTree) error {
+		interior := &testBlock{data: concatHash(tree.nodes[0][0], tree.nodes[0][1])}
+		proof := &Proof{Siblings: tree.Proofs[0].Siblings[1:], Path: tree.Proofs[0].Path >> 1}
+		return Verify(interior, proof, tree.Root, &Config{HashScheme: tree.HashScheme})
+	}
+
+	if err = secondPreimage(legacyTree); err != nil {
+		t.Fatalf("Expected the legacy scheme to accept an interior node as a leaf: %s", err)
+	}
+
+	if err = secondPreimage(tree); err == nil {
+		t.Fatal("Interior node verified as a leaf under the RFC 6962 scheme")
+	}
+}
+
+func TestLog(t *testing.T) {
+	// Test vectors from the Certificate Transparency reference implementation
+	leaves := []string{"", "\x00", "\x10", "\x20\x21", "\x30\x31", "\x40\x41\x42\x43",
+		"\x50\x51\x52\x53\x54\x55\x56\x57", "\x60\x61\x62\x63\x64\x65\x66\x67\x68\x69\x6a\x6b\x6c\x6d\x6e\x6f"}
+	roots := []string{
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+
+	log := NewLog(nil)
+	for i, leaf := range leaves {
+		index, err := log.Append(&testBlock{data: []byte(leaf)})
+		if err != nil {
+			t.Fatalf("Could not append leaf: %s", err)
+		}
+		if index != uint64(i) {
+			t.Fatalf("Leaf appended at index %d, expected %d", index, i)
+		}
+
+		root, err := log.Root()
+		if err != nil {
+			t.Fatalf("Could not compute root: %s", err)
+		}
+		if fmt.Sprintf("%x", root) != roots[i] {
+			t.Fatalf("Root of size %d is %x, expected %s", i+1, root, roots[i])
+		}
+	}
+
+	for size := uint64(1); size <= uint64(len(leaves)); size++ {
+		root, err := log.RootAt(size)
+		if err != nil {
+			t.Fatalf("Could not compute root: %s", err)
+		}
+
+		for index := uint64(0); index < size; index++ {
+			proof, err := log.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("Could not generate inclusion proof: %s", err)
+			}
+
+			err = VerifyInclusion(&testBlock{data: []byte(leaves[index])}, index, size, proof, root, nil)
+			if err != nil {
+				t.Fatalf("Inclusion proof for %d in %d failed to verify: %s", index, size, err)
+			}
+
+			err = VerifyInclusion(&testBlock{data: []byte("other")}, index, size, proof, root, nil)
+			if err == nil {
+				t.Fatalf("Inclusion proof for %d in %d verified the wrong leaf", index, size)
+			}
+		}
+
+		for first := uint64(1); first <= size; first++ {
+			firstRoot, err := log.RootAt(first)
+			if err != nil {
+				t.Fatalf("Could not compute root: %s", err)
+			}
+
+			proof, err := log.ConsistencyProof(first, size)
+			if err != nil {
+				t.Fatalf("Could not generate consistency proof: %s", err)
+			}
+
+			err = VerifyConsistency(first, size, firstRoot, root, proof, nil)
+			if err != nil {
+				t.Fatalf("Consistency proof from %d to %d failed to verify: %s", first, size, err)
+			}
+
+			if first < size {
+				err = VerifyConsistency(first, size, root, root, proof, nil)
+				if err == nil {
+					t.Fatalf("Consistency proof from %d to %d verified the wrong root", first, size)
+				}
+			}
+		}
+	}
+}
+
+func TestUpdateAppendRemove(t *testing.T) {
+	config := &Config{Mode: ModeTreeBuild}
+
+	blockMap := createTestBlocks(5)
+
+	tree, err := New(config, blockMap)
+	if err != nil {
+		t.Fatalf("Could not build tree: %s", err)
+	}
+
+	blocks := sortedTestBlocks(tree, blockMap)
+
+	// check rebuilds the tree from scratch and compares it with the incrementally updated one
+	check := func(step string) {
+		blockMap := map[string]DataBlock{}
+		for i, block := range blocks {
+			blockMap[fmt.Sprintf("%04d", i)] = block
+		}
+
+		expected, err := New(config, blockMap)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		if string(expected.Root) != string(tree.Root) || expected.Depth != tree.Depth {
+			t.Fatalf("Tree after %s does not match a full rebuild", step)
+		}
+
+		for i, block := range blocks {
+			proof, err := tree.ProofAt(i)
+			if err != nil {
+				t.Fatalf("Could not generate proof: %s", err)
+			}
+
+			err = tree.Verify(block, proof)
+			if err != nil {
+				t.Fatalf("Proof %d after %s failed to verify: %s", i, step, err)
+			}
+		}
+	}
+
+	for i := 0; i < 12; i++ {
+		block := &testBlock{data: []byte(fmt.Sprintf("appended %d", i))}
+		proof, err := tree.Append(block)
+		if err != nil {
+			t.Fatalf("Could not append: %s", err)
+		}
+
+		blocks = append(blocks, block)
+		if err = tree.Verify(block, proof); err != nil {
+			t.Fatalf("Proof returned by append failed to verify: %s", err)
+		}
+
+		check("append")
+	}
+
+	for _, idx := range []int{0, 7, 16} {
+		block := &testBlock{data: []byte(fmt.Sprintf("updated %d", idx))}
+		proof, err := tree.Update(idx, block)
+		if err != nil {
+			t.Fatalf("Could not update: %s", err)
+		}
+
+		blocks[idx] = block
+		if err = tree.Verify(block, proof); err != nil {
+			t.Fatalf("Proof returned by update failed to verify: %s", err)
+		}
+
+		check("update")
+	}
+
+	for _, idx := range []int{16, 3, 0, 9, 12} {
+		if err = tree.Remove(idx); err != nil {
+			t.Fatalf("Could not remove: %s", err)
+		}
+
+		blocks = append(blocks[:idx], blocks[idx+1:]...)
+		check("remove")
+	}
+}
+
+func TestSerialization(t *testing.T) {
+	blocks := createTestBlocks(7)
+
+	for _, mode := range []TypeConfigMode{ModeProofGen, ModeTreeBuild, ModeProofGenAndTreeBuild} {
+		tree, err := New(&Config{Mode: mode, HashScheme: HashSchemeRFC6962, SortSiblingPairs: true}, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		binaryData, err := tree.ToBinary()
+		if err != nil {
+			t.Fatalf("Could not encode tree: %s", err)
+		}
+
+		cborData, err := tree.ToCBOR()
+		if err != nil {
+			t.Fatalf("Could not encode tree: %s", err)
+		}
+
+		fromBinary, err := TreeFromBinary(binaryData, nil)
+		if err != nil {
+			t.Fatalf("Could not decode tree: %s", err)
+		}
+
+		fromCBOR, err := TreeFromCBOR(cborData, nil)
+		if err != nil {
+			t.Fatalf("Could not decode tree: %s", err)
+		}
+
+		_, err = TreeFromBinary(binaryData[:len(binaryData)-1], nil)
+		if err == nil {
+			t.Fatal("Truncated tree decoded")
+		}
+
+		for _, decoded := range []*MerkleTree{fromBinary, fromCBOR} {
+			if string(decoded.Root) != string(tree.Root) || decoded.HashScheme != tree.HashScheme || !decoded.SortSiblingPairs {
+				t.Fatal("Decoded tree does not match the original")
+			}
+
+			for i, block := range sortedTestBlocks(tree, blocks) {
+				var proof *Proof
+				if mode == ModeProofGen {
+					proof = decoded.Proofs[i]
+				} else if proof, err = decoded.Proof(block); err != nil {
+					t.Fatalf("Could not generate proof from decoded tree: %s", err)
+				}
+
+				if err = decoded.Verify(block, proof); err != nil {
+					t.Fatalf("Proof from decoded tree failed to verify: %s", err)
+				}
+
+				encodedProof, err := proof.ToBinary()
+				if err != nil {
+					t.Fatalf("Could not encode proof: %s", err)
+				}
+
+				decodedProof, err := ProofFromBinary(encodedProof)
+				if err != nil {
+					t.Fatalf("Could not decode proof: %s", err)
+				}
+
+				if err = tree.Verify(block, decodedProof); err != nil {
+					t.Fatalf("Decoded proof failed to verify: %s", err)
+				}
+			}
+		}
+	}
+
+	tree, err := New(nil, blocks)
+	if err != nil {
+		t.Fatalf("Could not build tree: %s", err)
+	}
+
+	rangeProof, err := tree.RangeProof(2, 5)
+	if err != nil {
+		t.Fatalf("Could not generate range proof: %s", err)
+	}
+
+	cborData, err := rangeProof.ToCBOR()
+	if err != nil {
+		t.Fatalf("Could not encode range proof: %s", err)
+	}
+
+	decodedRangeProof, err := RangeProofFromCBOR(cborData)
+	if err != nil {
+		t.Fatalf("Could not decode range proof: %s", err)
+	}
+
+	err = VerifyRange(sortedTestBlocks(tree, blocks)[2:5], decodedRangeProof, tree.Root, nil)
+	if err != nil {
+		t.Fatalf("Decoded range proof failed to verify: %s", err)
+	}
+}
+
+func TestArity(t *testing.T) {
+	for _, count := range []int{2, 3, 16, 17, 100} {
+		blocks := createTestBlocks(count)
+
+		binaryTree, err := New(nil, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		explicitBinaryTree, err := New(&Config{Arity: 2}, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		if string(binaryTree.Root) != string(explicitBinaryTree.Root) {
+			t.Fatal("Tree with an arity of 2 does not match the default binary tree")
+		}
+
+		for _, arity := range []int{3, 4, 16} {
+			config := &Config{Arity: arity, Mode: ModeProofGenAndTreeBuild, HashScheme: HashSchemeRFC6962}
+			tree, err := New(config, blocks)
+			if err != nil {
+				t.Fatalf("Could not build tree: %s", err)
+			}
+
+			if tree.Depth != karyDepth(count, arity) {
+				t.Fatalf("Tree of %d leaves with arity %d has depth %d", count, arity, tree.Depth)
+			}
+
+			encoded, err := tree.ToBinary()
+			if err != nil {
+				t.Fatalf("Could not encode tree: %s", err)
+			}
+
+			decoded, err := TreeFromBinary(encoded, nil)
+			if err != nil {
+				t.Fatalf("Could not decode tree: %s", err)
+			}
+
+			verifyConfig := &Config{Arity: arity, HashScheme: HashSchemeRFC6962}
+			for i, block := range sortedTestBlocks(tree, blocks) {
+				if len(tree.Proofs[i].Siblings) != tree.Depth*(arity-1) {
+					t.Fatalf("Proof has %d siblings, expected %d", len(tree.Proofs[i].Siblings), tree.Depth*(arity-1))
+				}
+
+				err = Verify(block, tree.Proofs[i], tree.Root, verifyConfig)
+				if err != nil {
+					t.Fatalf("Proof %d of %d with arity %d failed to verify: %s", i, count, arity, err)
+				}
+
+				proof, err := decoded.Proof(block)
+				if err != nil {
+					t.Fatalf("Could not generate proof: %s", err)
+				}
+
+				err = Verify(block, proof, tree.Root, verifyConfig)
+				if err != nil {
+					t.Fatalf("Proof from decoded tree failed to verify: %s", err)
+				}
+
+				tampered := &Proof{Path: proof.Path, Siblings: append([][]byte{[]byte("tampered")}, proof.Siblings[1:]...)}
+				err = Verify(block, tampered, tree.Root, verifyConfig)
+				if err == nil {
+					t.Fatal("Proof with a tampered sibling verified")
+				}
+			}
+		}
+	}
+}
+
+func TestDiskTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "disktree")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, count := range []int{2, 3, 7, 64, 1000} {
+		blocks := createTestBlocks(count)
+
+		memoryTree, err := New(&Config{Mode: ModeProofGenAndTreeBuild}, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		sorted := sortedTestBlocks(memoryTree, blocks)
+		iterator := func(yield func(DataBlock) bool) {
+			for _, block := range sorted {
+				if !yield(block) {
+					return
+				}
+			}
+		}
+
+		tree, err := NewDiskTree(nil, dir, iterator)
+		if err != nil {
+			t.Fatalf("Could not build disk tree: %s", err)
+		}
+
+		if string(tree.Root) != string(memoryTree.Root) || tree.Depth != memoryTree.Depth {
+			t.Fatalf("Disk tree of %d leaves does not match the in-memory tree", count)
+		}
+
+		for i, block := range sorted {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("Could not generate proof: %s", err)
+			}
+
+			if proof.Path != memoryTree.Proofs[i].Path || len(proof.Siblings) != len(memoryTree.Proofs[i].Siblings) {
+				t.Fatalf("Proof %d of %d does not match the in-memory proof", i, count)
+			}
+
+			err = tree.Verify(block, proof)
+			if err != nil {
+				t.Fatalf("Proof %d of %d failed to verify: %s", i, count, err)
+			}
+
+			err = tree.Verify(sorted[(i+1)%count], proof)
+			if err == nil {
+				t.Fatalf("Proof %d of %d verified the wrong block", i, count)
+			}
+		}
+
+		if _, err = tree.Proof(count); err != ErrLeafIndexOutOfRange {
+			t.Fatalf("Expected ErrLeafIndexOutOfRange, got %v", err)
+		}
+
+		err = tree.Close()
+		if err != nil {
+			t.Fatalf("Could not close disk tree: %s", err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Disk trees left %d files behind", len(entries))
+	}
+
+	_, err = NewDiskTree(nil, dir, func(yield func(DataBlock) bool) {
+		yield(&testBlock{data: []byte("single")})
+	})
+	if err != ErrInvalidNumOfDataBlocks {
+		t.Fatalf("Expected ErrInvalidNumOfDataBlocks, got %v", err)
+	}
+}
+
+func TestNewFromSliceAndIterator(t *testing.T) {
+	for _, count := range []int{2, 5, 16} {
+		blocks := createTestBlocks(count)
+
+		mapTree, err := New(nil, blocks)
+		if err != nil {
+			t.Fatalf("Could not build tree: %s", err)
+		}
+
+		sorted := sortedTestBlocks(mapTree, blocks)
+
+		sliceTree, err := NewFromSlice(nil, sorted)
+		if err != nil {
+			t.Fatalf("Could not build tree from slice: %s", err)
+		}
+
+		iteratorTree, err := NewFromIterator(&Config{Mode: ModeProofGenAndTreeBuild}, func(yield func(DataBlock) bool) {
+			for _, block := range sorted {
+				if !yield(block) {
+					return
+				}
+			}
+		})
+		if err != nil {
+			t.Fatalf("Could not build tree from iterator: %s", err)
+		}
+
+		if string(sliceTree.Root) != string(mapTree.Root) || string(iteratorTree.Root) != string(mapTree.Root) {
+			t.Fatalf("Trees of %d blocks in key order do not match the map tree", count)
+		}
+
+		for i, block := range sorted {
+			err = Verify(block, sliceTree.Proofs[i], mapTree.Root, nil)
+			if err != nil {
+				t.Fatalf("Proof %d of the slice tree failed to verify: %s", i, err)
+			}
+		}
+
+		// The caller's order is kept, so a different order gives a different root
+		reversed := make([]DataBlock, 0, count)
+		for i := count - 1; i >= 0; i-- {
+			reversed = append(reversed, sorted[i])
+		}
+
+		reversedTree, err := NewFromSlice(nil, reversed)
+		if err != nil {
+			t.Fatalf("Could not build tree from slice: %s", err)
+		}
+
+		if string(reversedTree.Root) == string(mapTree.Root) {
+			t.Fatal("Reversed slice produced the same root as the sorted blocks")
+		}
+	}
+
+	_, err := NewFromSlice(nil, []DataBlock{&testBlock{data: []byte("single")}})
+	if err != ErrInvalidNumOfDataBlocks {
+		t.Fatalf("Expected ErrInvalidNumOfDataBlocks, got %v", err)
+	}
+
+	_, err = NewFromIterator(nil, func(yield func(DataBlock) bool) {
+		for _, block := range []DataBlock{&testBlock{data: []byte("first")}, nil, &testBlock{data: []byte("last")}} {
+			if !yield(block) {
+				return
+			}
+		}
+	})
+	if err != ErrDataBlockIsNil {
+		t.Fatalf("Expected ErrDataBlockIsNil, got %v", err)
+	}
+}
+
+func TestStandardTree(t *testing.T) {
+	// The example of OpenZeppelin's merkle-tree README
+	values := [][]interface{}{
+		{"0x1111111111111111111111111111111111111111", "5000000000000000000"},
+		{"0x2222222222222222222222222222222222222222", "2500000000000000000"},
+	}
+	leafEncoding := []string{"address", "uint256"}
+
+	tree, err := NewStandardTree(values, leafEncoding)
+	if err != nil {
+		t.Fatalf("Could not build standard tree: %s", err)
+	}
+
+	if tree.Root().String() != "0xd4dee0beab2d53f2cc83e567171bd2820e49898130a22622b10ead383e90bd77" {
+		t.Fatalf("Unexpected root %s", tree.Root())
+	}
+
+	hash, err := Keccak256HashFunc([]byte(""))
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if HexBytes(hash).String() != "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470" {
+		t.Fatalf("Unexpected keccak256 of the empty string %s", HexBytes(hash))
+	}
+
+	values = [][]interface{}{}
+	for i := 0; i < 11; i++ {
+		values = append(values, []interface{}{i, fmt.Sprintf("leaf %d", i), i%2 == 0})
+	}
+	leafEncoding = []string{"uint256", "string", "bool"}
+
+	tree, err = NewStandardTree(values, leafEncoding)
+	if err != nil {
+		t.Fatalf("Could not build standard tree: %s", err)
+	}
+
+	for i := range values {
+		proof, err := tree.Proof(i)
+		if err != nil {
+			t.Fatalf("Could not generate proof: %s", err)
+		}
+
+		err = VerifyStandardProof(tree.Root(), leafEncoding, tree.Values[i].Value, proof)
+		if err != nil {
+			t.Fatalf("Proof %d failed to verify: %s", i, err)
+		}
+
+		err = VerifyStandardProof(tree.Root(), leafEncoding, tree.Values[(i+1)%len(values)].Value, proof)
+		if err == nil {
+			t.Fatalf("Proof %d verified the wrong value", i)
+		}
+	}
+
+	for _, indices := range [][]int{{0}, {3, 7}, {0, 1, 2, 10}, {}} {
+		multiProof, err := tree.MultiProof(indices)
+		if err != nil {
+			t.Fatalf("Could not generate multiproof: %s", err)
+		}
+
+		err = VerifyStandardMultiProof(tree.Root(), leafEncoding, multiProof)
+		if err != nil {
+			t.Fatalf("Multiproof of %v failed to verify: %s", indices, err)
+		}
+	}
+
+	_, err = tree.MultiProof([]int{2, 2})
+	if err == nil {
+		t.Fatal("Multiproof with a duplicated index was generated")
+	}
+
+	dump, err := tree.Dump()
+	if err != nil {
+		t.Fatalf("Could not dump standard tree: %s", err)
+	}
+
+	loaded, err := LoadStandardTree(dump)
+	if err != nil {
+		t.Fatalf("Could not load standard tree: %s", err)
+	}
+
+	if loaded.Root().String() != tree.Root().String() {
+		t.Fatal("Loaded standard tree has a different root")
+	}
+
+	proof, err := loaded.Proof(4)
+	if err != nil {
+		t.Fatalf("Could not generate proof: %s", err)
+	}
+
+	err = VerifyStandardProof(tree.Root(), leafEncoding, values[4], proof)
+	if err != nil {
+		t.Fatalf("Proof from loaded tree failed to verify: %s", err)
+	}
+
+	loaded.Values[0].Value[1] = "tampered"
+	if loaded.Validate() == nil {
+		t.Fatal("Tampered standard tree passed validation")
+	}
+
+	// Integers are decimal unless 0x prefixed, like in ethers
+	encodeInt := func(value string) string {
+		leaf, err := StandardLeafHash([]string{"int256"}, []interface{}{value})
+		if err != nil {
+			return "error"
+		}
+		return hex.EncodeToString(leaf)
+	}
+
+	for _, equal := range [][2]string{{"010", "10"}, {"0x10", "16"}, {"-0x10", "-16"}} {
+		if encodeInt(equal[0]) == "error" || encodeInt(equal[0]) != encodeInt(equal[1]) {
+			t.Fatalf("%s was not encoded as %s", equal[0], equal[1])
+		}
+	}
+
+	for _, invalid := range []string{"0b1", "0o7", "1_000", "0x", "0x1_0"} {
+		if encodeInt(invalid) != "error" {
+			t.Fatalf("%s was accepted as an integer", invalid)
+		}
+	}
+}
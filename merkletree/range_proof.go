@@ -0,0 +1,192 @@
+package merkletree
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+)
+
+var (
+	// ErrInvalidRange is the error for a leaf range that is empty or out of the tree bounds.
+	ErrInvalidRange = errors.New("invalid leaf range")
+	// ErrRangeProofInvalid is the error for a range proof that does not match the data blocks or the root.
+	ErrRangeProofInvalid = errors.New("range proof verification failed")
+)
+
+// RangeProof represents a Merkle Tree proof for a contiguous span of leaves.
+// Together with the data blocks of the span it recomputes the root, which proves that the blocks
+// are exactly the leaves at positions [Start, End) of a tree with NumLeaves leaves and that no leaf
+// inside the span was omitted.
+type RangeProof struct {
+	Start     int      // Index of the first leaf in the span.
+	End       int      // Index one past the last leaf in the span.
+	NumLeaves int      // Number of leaves in the tree the proof belongs to.
+	Siblings  [][]byte // Nodes bordering the span, ordered by level from the leaves up, left before right.
+}
+
+// RangeProof generates a proof for the leaves at positions [start, end).
+// The tree nodes are used when they were built (ModeTreeBuild or ModeProofGenAndTreeBuild),
+// otherwise they are recomputed from the leaves.
+func (m *MerkleTree) RangeProof(start, end int) (*RangeProof, error) {
+	if m.isKary() {
+		return nil, ErrArityUnsupported
+	}
+	if start < 0 || end > m.NumLeaves || start >= end {
+		return nil, ErrInvalidRange
+	}
+
+	levels := m.nodes
+	if levels == nil {
+		var err error
+		if levels, err = m.computeLevels(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		siblings [][]byte
+		lo, hi   = start, end
+		count    = m.NumLeaves
+	)
+	for i := 0; i < m.Depth; i++ {
+		if lo&1 == 1 {
+			siblings = append(siblings, levels[i][lo-1])
+			lo--
+		}
+		if hi&1 == 1 {
+			// The right neighbour of the last node of an odd level is its own duplicate,
+			// which the verifier can recompute, so it is left out of the proof.
+			if hi < count {
+				siblings = append(siblings, levels[i][hi])
+			}
+			hi++
+		}
+		lo >>= 1
+		hi >>= 1
+		count = (count + 1) >> 1
+	}
+
+	return &RangeProof{
+		Start:     start,
+		End:       end,
+		NumLeaves: m.NumLeaves,
+		Siblings:  siblings,
+	}, nil
+}
+
+// computeLevels computes the padded node levels of the tree from its leaves,
+// in the same layout as buildTree, without storing them in the tree.
+func (m *MerkleTree) computeLevels() ([][][]byte, error) {
+	levels := make([][][]byte, m.Depth)
+	levels[0] = make([][]byte, m.NumLeaves)
+	copy(levels[0], m.Leaves)
+	var (
+		bufferLength int
+		err          error
+	)
+	levels[0], bufferLength = m.fixOddLength(levels[0], m.NumLeaves)
+	for i := 0; i < m.Depth-1; i++ {
+		levels[i+1] = make([][]byte, bufferLength>>1)
+		for j := 0; j < bufferLength; j += 2 {
+			if levels[i+1][j>>1], err = m.HashFunc(
+				m.concatHashFunc(levels[i][j], levels[i][j+1]),
+			); err != nil {
+				return nil, err
+			}
+		}
+		levels[i+1], bufferLength = m.fixOddLength(levels[i+1], len(levels[i+1]))
+	}
+	return levels, nil
+}
+
+// VerifyRange checks that the data blocks are exactly the leaves covered by the range proof,
+// in order, using the provided Merkle root hash.
+// Because the proof commits to the number of leaves, callers that know the expected size of the tree
+// should compare it with proof.NumLeaves to make sure the span is the one they asked for.
+func VerifyRange(blocks []DataBlock, proof *RangeProof, root []byte, config *Config) error {
+	// Validate input parameters.
+	if proof == nil {
+		return ErrProofIsNil
+	}
+	if proof.NumLeaves <= 1 || proof.Start < 0 || proof.End > proof.NumLeaves || proof.Start >= proof.End {
+		return ErrInvalidRange
+	}
+	if len(blocks) != proof.End-proof.Start {
+		return ErrRangeProofInvalid
+	}
+	if config == nil {
+		config = new(Config)
+	}
+	if config.HashFunc == nil {
+		config.HashFunc = DefaultHashFunc
+	}
+	if !config.HashScheme.valid() {
+		return ErrInvalidHashScheme
+	}
+	if config.isKary() {
+		return ErrArityUnsupported
+	}
+
+	// Determine the concatenation function based on the configuration.
+	concatFunc := concatHashFuncFor(config)
+
+	// Convert the data blocks to leaves.
+	nodes := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		if block == nil {
+			return ErrDataBlockIsNil
+		}
+		leaf, err := dataBlockToLeaf(block, config)
+		if err != nil {
+			return err
+		}
+		nodes[i] = leaf
+	}
+
+	// Rebuild the span level by level, pulling in the bordering nodes from the proof.
+	var (
+		lo, hi = proof.Start, proof.End
+		count  = proof.NumLeaves
+		depth  = bits.Len(uint(proof.NumLeaves - 1))
+		next   int
+		err    error
+	)
+	for i := 0; i < depth; i++ {
+		if lo&1 == 1 {
+			if next >= len(proof.Siblings) {
+				return ErrRangeProofInvalid
+			}
+			nodes = append([][]byte{proof.Siblings[next]}, nodes...)
+			next++
+			lo--
+		}
+		if hi&1 == 1 {
+			if hi < count {
+				if next >= len(proof.Siblings) {
+					return ErrRangeProofInvalid
+				}
+				nodes = append(nodes, proof.Siblings[next])
+				next++
+			} else {
+				nodes = append(nodes, nodes[len(nodes)-1])
+			}
+			hi++
+		}
+		parents := make([][]byte, len(nodes)>>1)
+		for j := 0; j < len(nodes); j += 2 {
+			if parents[j>>1], err = config.HashFunc(concatFunc(nodes[j], nodes[j+1])); err != nil {
+				return err
+			}
+		}
+		nodes = parents
+		lo >>= 1
+		hi >>= 1
+		count = (count + 1) >> 1
+	}
+
+	if next != len(proof.Siblings) || len(nodes) != 1 || !bytes.Equal(nodes[0], root) {
+		return ErrRangeProofInvalid
+	}
+
+	return nil
+}
@@ -0,0 +1,646 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	cbor "github.com/fxamacker/cbor/v2"
+)
+
+// Wire formats
+//
+// Proofs, range proofs and built trees have a versioned binary encoding and a versioned CBOR encoding.
+// All integers in the binary encodings are big-endian and unsigned. A byte string is written as a 4 byte
+// length followed by the bytes, and a list as a 4 byte count followed by its items.
+//
+// Proof, binary version 1:
+//
+//	version   1 byte   0x01
+//	path      4 bytes  bit i is set when the proven node is the left child at level i,
+//	                   so Siblings[i] is hashed on its right, otherwise on its left
+//	siblings  list of byte strings, from the leaf level up
+//
+// RangeProof, binary version 1:
+//
+//	version    1 byte   0x01
+//	start      4 bytes  index of the first leaf of the span
+//	end        4 bytes  index one past the last leaf of the span
+//	numLeaves  4 bytes  number of leaves of the tree
+//	siblings   list of byte strings, by level from the leaves up, left neighbour before right neighbour
+//
+// MerkleTree, binary version 1:
+//
+//	magic      4 bytes  "SMKT"
+//	version    1 byte   0x01
+//	flags      1 byte   bit 0: SortSiblingPairs, bit 1: DisableLeafHashing
+//	scheme     1 byte   HashScheme, 0 legacy, 1 RFC 6962
+//	mode       1 byte   Mode, 0 proof generation, 1 tree building, 2 both
+//	arity      4 bytes  children per interior node, 0 for a binary tree
+//	numLeaves  4 bytes
+//	depth      4 bytes
+//	root       byte string
+//	keys       list of byte strings holding UTF-8 keys, empty when the tree was not built from a map
+//	leaves     list of byte strings
+//	levels     list of levels, each a list of byte strings, empty when the tree was not built.
+//	           Level 0 holds the leaves, every level whose length is not a multiple of the arity
+//	           is padded by repeating its last node
+//	proofs     list of byte strings, each holding a proof in its binary encoding, empty when no proofs
+//	           were generated
+//
+// For trees with an arity above 2 the proof path holds the leaf index, see Config.Arity.
+//
+// The CBOR encodings are maps with the text keys of the CBORProof, CBORRangeProof and CBORTree types.
+//
+// The hash function is not encoded, it has to be provided when decoding a tree.
+
+const (
+	// ProofEncodingVersion is the version of the proof and range proof encodings.
+	ProofEncodingVersion = 1
+	// TreeEncodingVersion is the version of the tree encoding.
+	TreeEncodingVersion = 1
+)
+
+const (
+	treeFlagSortSiblingPairs byte = 1 << iota
+	treeFlagDisableLeafHashing
+)
+
+var (
+	// ErrInvalidEncoding is the error for encoded data that is truncated or malformed.
+	ErrInvalidEncoding = errors.New("invalid encoding")
+	// ErrUnsupportedEncodingVersion is the error for encoded data of an unknown version.
+	ErrUnsupportedEncodingVersion = errors.New("unsupported encoding version")
+)
+
+// treeMagic starts the binary encoding of a tree.
+var treeMagic = []byte("SMKT")
+
+// CBORProof is the CBOR representation of a Proof.
+type CBORProof struct {
+	Version  int      `cbor:"version"`
+	Path     uint32   `cbor:"path"`
+	Siblings [][]byte `cbor:"siblings"`
+}
+
+// CBORRangeProof is the CBOR representation of a RangeProof.
+type CBORRangeProof struct {
+	Version   int      `cbor:"version"`
+	Start     uint32   `cbor:"start"`
+	End       uint32   `cbor:"end"`
+	NumLeaves uint32   `cbor:"numLeaves"`
+	Siblings  [][]byte `cbor:"siblings"`
+}
+
+// CBORTree is the CBOR representation of a MerkleTree.
+type CBORTree struct {
+	Version            int          `cbor:"version"`
+	SortSiblingPairs   bool         `cbor:"sortSiblingPairs"`
+	DisableLeafHashing bool         `cbor:"disableLeafHashing"`
+	HashScheme         int          `cbor:"hashScheme"`
+	Mode               int          `cbor:"mode"`
+	Arity              uint32       `cbor:"arity"`
+	NumLeaves          uint32       `cbor:"numLeaves"`
+	Depth              uint32       `cbor:"depth"`
+	Root               []byte       `cbor:"root"`
+	Keys               []string     `cbor:"keys"`
+	Leaves             [][]byte     `cbor:"leaves"`
+	Levels             [][][]byte   `cbor:"levels"`
+	Proofs             []*CBORProof `cbor:"proofs"`
+}
+
+// ToBinary encodes the proof in its binary format.
+func (p *Proof) ToBinary() ([]byte, error) {
+	var w encodingWriter
+	w.putByte(ProofEncodingVersion)
+	w.putUint32(p.Path)
+	if err := w.putBytesList(p.Siblings); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// ProofFromBinary decodes a proof from its binary format.
+func ProofFromBinary(data []byte) (*Proof, error) {
+	r := encodingReader{data: data}
+	proof, err := r.proof()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// ToCBOR encodes the proof in CBOR.
+func (p *Proof) ToCBOR() ([]byte, error) {
+	return cbor.Marshal(p.toCBOR())
+}
+
+// ProofFromCBOR decodes a proof from CBOR.
+func ProofFromCBOR(data []byte) (*Proof, error) {
+	var encoded CBORProof
+	if err := cbor.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	return encoded.proof()
+}
+
+func (p *Proof) toCBOR() *CBORProof {
+	return &CBORProof{
+		Version:  ProofEncodingVersion,
+		Path:     p.Path,
+		Siblings: p.Siblings,
+	}
+}
+
+func (p *CBORProof) proof() (*Proof, error) {
+	if p.Version != ProofEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+	return &Proof{
+		Path:     p.Path,
+		Siblings: p.Siblings,
+	}, nil
+}
+
+// ToBinary encodes the range proof in its binary format.
+func (p *RangeProof) ToBinary() ([]byte, error) {
+	if err := p.checkEncodable(); err != nil {
+		return nil, err
+	}
+	var w encodingWriter
+	w.putByte(ProofEncodingVersion)
+	w.putUint32(uint32(p.Start))
+	w.putUint32(uint32(p.End))
+	w.putUint32(uint32(p.NumLeaves))
+	if err := w.putBytesList(p.Siblings); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// RangeProofFromBinary decodes a range proof from its binary format.
+func RangeProofFromBinary(data []byte) (*RangeProof, error) {
+	r := encodingReader{data: data}
+	version, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if version != ProofEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+	var proof RangeProof
+	var start, end, numLeaves uint32
+	if start, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if end, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if numLeaves, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if proof.Siblings, err = r.bytesList(); err != nil {
+		return nil, err
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+	proof.Start, proof.End, proof.NumLeaves = int(start), int(end), int(numLeaves)
+	return &proof, nil
+}
+
+// ToCBOR encodes the range proof in CBOR.
+func (p *RangeProof) ToCBOR() ([]byte, error) {
+	if err := p.checkEncodable(); err != nil {
+		return nil, err
+	}
+	return cbor.Marshal(&CBORRangeProof{
+		Version:   ProofEncodingVersion,
+		Start:     uint32(p.Start),
+		End:       uint32(p.End),
+		NumLeaves: uint32(p.NumLeaves),
+		Siblings:  p.Siblings,
+	})
+}
+
+// RangeProofFromCBOR decodes a range proof from CBOR.
+func RangeProofFromCBOR(data []byte) (*RangeProof, error) {
+	var encoded CBORRangeProof
+	if err := cbor.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	if encoded.Version != ProofEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+	return &RangeProof{
+		Start:     int(encoded.Start),
+		End:       int(encoded.End),
+		NumLeaves: int(encoded.NumLeaves),
+		Siblings:  encoded.Siblings,
+	}, nil
+}
+
+// checkEncodable makes sure the positions of the range proof fit in the 4 byte fields of the encodings.
+func (p *RangeProof) checkEncodable() error {
+	if p.Start < 0 || p.End < 0 || p.NumLeaves < 0 || uint64(p.NumLeaves) > 1<<32-1 {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// ToBinary encodes the tree in its binary format, including the node levels and the generated proofs,
+// so that it can be reloaded without rehashing.
+func (m *MerkleTree) ToBinary() ([]byte, error) {
+	if uint64(m.NumLeaves) > 1<<32-1 {
+		return nil, ErrInvalidEncoding
+	}
+	var w encodingWriter
+	w.Write(treeMagic)
+	w.putByte(TreeEncodingVersion)
+	var flags byte
+	if m.SortSiblingPairs {
+		flags |= treeFlagSortSiblingPairs
+	}
+	if m.DisableLeafHashing {
+		flags |= treeFlagDisableLeafHashing
+	}
+	w.putByte(flags)
+	w.putByte(byte(m.HashScheme))
+	w.putByte(byte(m.Mode))
+	w.putUint32(uint32(m.Arity))
+	w.putUint32(uint32(m.NumLeaves))
+	w.putUint32(uint32(m.Depth))
+	if err := w.putBytes(m.Root); err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, len(m.Keys))
+	for i, key := range m.Keys {
+		keys[i] = []byte(key)
+	}
+	if err := w.putBytesList(keys); err != nil {
+		return nil, err
+	}
+	if err := w.putBytesList(m.Leaves); err != nil {
+		return nil, err
+	}
+	w.putUint32(uint32(len(m.nodes)))
+	for _, level := range m.nodes {
+		if err := w.putBytesList(level); err != nil {
+			return nil, err
+		}
+	}
+	w.putUint32(uint32(len(m.Proofs)))
+	for _, proof := range m.Proofs {
+		encoded, err := proof.ToBinary()
+		if err != nil {
+			return nil, err
+		}
+		if err = w.putBytes(encoded); err != nil {
+			return nil, err
+		}
+	}
+	return w.Bytes(), nil
+}
+
+// TreeFromBinary decodes a tree from its binary format.
+// The hash function is not part of the encoding, if hashFunc is nil SHA256 is used.
+func TreeFromBinary(data []byte, hashFunc TypeHashFunc) (*MerkleTree, error) {
+	r := encodingReader{data: data}
+	magic, err := r.next(len(treeMagic))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(magic, treeMagic) {
+		return nil, ErrInvalidEncoding
+	}
+	version, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if version != TreeEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+
+	var encoded CBORTree
+	encoded.Version = TreeEncodingVersion
+	var flags, scheme, mode byte
+	var numLeaves, depth uint32
+	if flags, err = r.byte(); err != nil {
+		return nil, err
+	}
+	encoded.SortSiblingPairs = flags&treeFlagSortSiblingPairs != 0
+	encoded.DisableLeafHashing = flags&treeFlagDisableLeafHashing != 0
+	if scheme, err = r.byte(); err != nil {
+		return nil, err
+	}
+	if mode, err = r.byte(); err != nil {
+		return nil, err
+	}
+	encoded.HashScheme, encoded.Mode = int(scheme), int(mode)
+	if encoded.Arity, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if numLeaves, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if depth, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	encoded.NumLeaves, encoded.Depth = numLeaves, depth
+	if encoded.Root, err = r.bytes(); err != nil {
+		return nil, err
+	}
+	keys, err := r.bytesList()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		encoded.Keys = append(encoded.Keys, string(key))
+	}
+	if encoded.Leaves, err = r.bytesList(); err != nil {
+		return nil, err
+	}
+	numLevels, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < numLevels; i++ {
+		level, err := r.bytesList()
+		if err != nil {
+			return nil, err
+		}
+		encoded.Levels = append(encoded.Levels, level)
+	}
+	numProofs, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < numProofs; i++ {
+		data, err := r.bytes()
+		if err != nil {
+			return nil, err
+		}
+		proof, err := ProofFromBinary(data)
+		if err != nil {
+			return nil, err
+		}
+		encoded.Proofs = append(encoded.Proofs, proof.toCBOR())
+	}
+	if err = r.done(); err != nil {
+		return nil, err
+	}
+	return encoded.tree(hashFunc)
+}
+
+// ToCBOR encodes the tree in CBOR, including the node levels and the generated proofs,
+// so that it can be reloaded without rehashing.
+func (m *MerkleTree) ToCBOR() ([]byte, error) {
+	if uint64(m.NumLeaves) > 1<<32-1 {
+		return nil, ErrInvalidEncoding
+	}
+	encoded := &CBORTree{
+		Version:            TreeEncodingVersion,
+		SortSiblingPairs:   m.SortSiblingPairs,
+		DisableLeafHashing: m.DisableLeafHashing,
+		HashScheme:         int(m.HashScheme),
+		Mode:               int(m.Mode),
+		Arity:              uint32(m.Arity),
+		NumLeaves:          uint32(m.NumLeaves),
+		Depth:              uint32(m.Depth),
+		Root:               m.Root,
+		Keys:               m.Keys,
+		Leaves:             m.Leaves,
+		Levels:             m.nodes,
+	}
+	for _, proof := range m.Proofs {
+		encoded.Proofs = append(encoded.Proofs, proof.toCBOR())
+	}
+	return cbor.Marshal(encoded)
+}
+
+// TreeFromCBOR decodes a tree from CBOR.
+// The hash function is not part of the encoding, if hashFunc is nil SHA256 is used.
+func TreeFromCBOR(data []byte, hashFunc TypeHashFunc) (*MerkleTree, error) {
+	var encoded CBORTree
+	if err := cbor.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	if encoded.Version != TreeEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+	return encoded.tree(hashFunc)
+}
+
+// tree validates the decoded fields and restores the tree from them.
+func (t *CBORTree) tree(hashFunc TypeHashFunc) (*MerkleTree, error) {
+	numLeaves := int(t.NumLeaves)
+	arity := int(t.Arity)
+	if arity == 1 || uint64(t.Arity) > 1<<31-1 {
+		return nil, ErrInvalidArity
+	}
+	depth := bits.Len(uint(numLeaves - 1))
+	if arity > 2 {
+		depth = karyDepth(numLeaves, arity)
+	} else {
+		arity = 2
+	}
+	if numLeaves <= 1 || len(t.Leaves) != numLeaves || int(t.Depth) != depth {
+		return nil, ErrInvalidEncoding
+	}
+	if len(t.Keys) != 0 && len(t.Keys) != numLeaves {
+		return nil, ErrInvalidEncoding
+	}
+	if len(t.Proofs) != 0 && len(t.Proofs) != numLeaves {
+		return nil, ErrInvalidEncoding
+	}
+
+	mode := TypeConfigMode(t.Mode)
+	built := mode == ModeTreeBuild || mode == ModeProofGenAndTreeBuild
+	if mode != ModeProofGen && !built {
+		return nil, ErrInvalidConfigMode
+	}
+	scheme := TypeHashScheme(t.HashScheme)
+	if !scheme.valid() {
+		return nil, ErrInvalidHashScheme
+	}
+
+	if hashFunc == nil {
+		hashFunc = DefaultHashFunc
+	}
+	m := &MerkleTree{
+		Config: Config{
+			HashFunc:           hashFunc,
+			Mode:               mode,
+			SortSiblingPairs:   t.SortSiblingPairs,
+			DisableLeafHashing: t.DisableLeafHashing,
+			HashScheme:         scheme,
+			Arity:              int(t.Arity),
+		},
+		Root:      t.Root,
+		Leaves:    t.Leaves,
+		Depth:     int(t.Depth),
+		NumLeaves: numLeaves,
+		Keys:      t.Keys,
+	}
+	m.concatHashFunc = concatHashFuncFor(&m.Config)
+
+	for _, encodedProof := range t.Proofs {
+		proof, err := encodedProof.proof()
+		if err != nil {
+			return nil, err
+		}
+		m.Proofs = append(m.Proofs, proof)
+	}
+
+	if built {
+		// Check the shape of every level, so that proofs can be served without bounds checks.
+		if len(t.Levels) != m.Depth {
+			return nil, ErrInvalidEncoding
+		}
+		count := numLeaves
+		for _, level := range t.Levels {
+			if len(level) != (count+arity-1)/arity*arity {
+				return nil, ErrInvalidEncoding
+			}
+			count = len(level) / arity
+		}
+		m.nodes = t.Levels
+		m.leafMap = make(map[string]int, numLeaves)
+		for i, leaf := range m.Leaves {
+			m.leafMap[string(leaf)] = i
+		}
+	} else if len(t.Levels) != 0 {
+		return nil, ErrInvalidEncoding
+	}
+
+	return m, nil
+}
+
+// encodingWriter writes the binary encodings.
+type encodingWriter struct {
+	bytes.Buffer
+}
+
+func (w *encodingWriter) putByte(b byte) {
+	w.WriteByte(b)
+}
+
+func (w *encodingWriter) putUint32(v uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	w.Write(buf[:])
+}
+
+func (w *encodingWriter) putBytes(b []byte) error {
+	if uint64(len(b)) > 1<<32-1 {
+		return ErrInvalidEncoding
+	}
+	w.putUint32(uint32(len(b)))
+	w.Write(b)
+	return nil
+}
+
+func (w *encodingWriter) putBytesList(list [][]byte) error {
+	if uint64(len(list)) > 1<<32-1 {
+		return ErrInvalidEncoding
+	}
+	w.putUint32(uint32(len(list)))
+	for _, b := range list {
+		if err := w.putBytes(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodingReader reads the binary encodings.
+type encodingReader struct {
+	data []byte
+}
+
+func (r *encodingReader) next(n int) ([]byte, error) {
+	if n < 0 || len(r.data) < n {
+		return nil, ErrInvalidEncoding
+	}
+	result := r.data[:n]
+	r.data = r.data[n:]
+	return result, nil
+}
+
+func (r *encodingReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *encodingReader) uint32() (uint32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (r *encodingReader) bytes() ([]byte, error) {
+	length, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.next(int(length))
+	if err != nil {
+		return nil, err
+	}
+	// Copy the bytes so the decoded values do not keep the whole input alive.
+	result := make([]byte, len(b))
+	copy(result, b)
+	return result, nil
+}
+
+func (r *encodingReader) bytesList() ([][]byte, error) {
+	count, err := r.uint32()
+	if err != nil {
+		return nil, err
+	}
+	// Every item takes at least its 4 byte length, which bounds the allocation for malformed input.
+	if uint64(count)*4 > uint64(len(r.data)) {
+		return nil, ErrInvalidEncoding
+	}
+	list := make([][]byte, count)
+	for i := range list {
+		if list[i], err = r.bytes(); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (r *encodingReader) proof() (*Proof, error) {
+	version, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	if version != ProofEncodingVersion {
+		return nil, ErrUnsupportedEncodingVersion
+	}
+	var proof Proof
+	if proof.Path, err = r.uint32(); err != nil {
+		return nil, err
+	}
+	if proof.Siblings, err = r.bytesList(); err != nil {
+		return nil, err
+	}
+	return &proof, nil
+}
+
+func (r *encodingReader) done() error {
+	if len(r.data) != 0 {
+		return ErrInvalidEncoding
+	}
+	return nil
+}
@@ -0,0 +1,593 @@
+package merkletree
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// StandardTreeFormat is the format name of the dumps of OpenZeppelin's StandardMerkleTree.
+const StandardTreeFormat = "standard-v1"
+
+var (
+	// ErrStandardTreeEmpty is the error for a standard tree without values.
+	ErrStandardTreeEmpty = errors.New("standard tree requires at least one value")
+	// ErrInvalidLeafEncoding is the error for an unsupported ABI type or a value that does not match its type.
+	ErrInvalidLeafEncoding = errors.New("invalid leaf encoding")
+	// ErrInvalidStandardTree is the error for a dump that is not a valid standard tree.
+	ErrInvalidStandardTree = errors.New("invalid standard tree dump")
+	// ErrStandardProofInvalid is the error for a standard proof or multiproof that does not lead to the root.
+	ErrStandardProofInvalid = errors.New("standard proof verification failed")
+)
+
+// Keccak256HashFunc is a TypeHashFunc implementing the keccak256 hash function of the EVM.
+// It creates a new digest for every call, so it is safe for concurrent use.
+func Keccak256HashFunc(data []byte) ([]byte, error) {
+	digest := sha3.NewLegacyKeccak256()
+	digest.Write(data)
+	return digest.Sum(make([]byte, 0, digest.Size())), nil
+}
+
+// keccak256 hashes the concatenation of the data with keccak256.
+func keccak256(data ...[]byte) []byte {
+	digest := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		digest.Write(d)
+	}
+	return digest.Sum(make([]byte, 0, digest.Size()))
+}
+
+// HexBytes is a byte slice encoded in JSON as a 0x prefixed hex string, the way the EVM tooling encodes hashes.
+type HexBytes []byte
+
+// String returns the 0x prefixed hex encoding of the bytes.
+func (h HexBytes) String() string {
+	return "0x" + hex.EncodeToString(h)
+}
+
+// MarshalJSON encodes the bytes as a 0x prefixed hex string.
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+// UnmarshalJSON decodes a 0x prefixed hex string.
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := decodeHex(s)
+	if err != nil {
+		return err
+	}
+	*h = decoded
+	return nil
+}
+
+// StandardTree is a Merkle Tree compatible with the StandardMerkleTree of OpenZeppelin's merkle-tree library
+// and with its MerkleProof Solidity library.
+// Every value is a tuple ABI encoded with LeafEncoding and hashed twice with keccak256 to form its leaf.
+// The leaves are sorted by hash and stored with the tree nodes in a single array, Tree[0] being the root,
+// the children of Tree[i] being Tree[2i+1] and Tree[2i+2], and sibling pairs being sorted before they are hashed.
+type StandardTree struct {
+	// LeafEncoding holds the ABI types of the values, e.g. ["address", "uint256"].
+	LeafEncoding []string
+	// Tree holds the nodes of the tree, the leaves at the end.
+	Tree []HexBytes
+	// Values holds the values in the order they were given and the index of their leaf in Tree.
+	Values []StandardValue
+	// leafIndex maps the hash of a leaf to the index of its value.
+	leafIndex map[string]int
+}
+
+// StandardValue is a value of a StandardTree along with the index of its leaf.
+// Values are kept in their JSON form: booleans for bool, strings for every other type,
+// with numbers in decimal and bytes in 0x prefixed hex.
+type StandardValue struct {
+	Value     []interface{} `json:"value"`
+	TreeIndex int           `json:"treeIndex"`
+}
+
+// StandardMultiProof proves several values of a StandardTree at once, as expected by MerkleProof.multiProofVerify.
+// Leaves holds the proven values in the order their leaves are consumed.
+type StandardMultiProof struct {
+	Leaves     [][]interface{} `json:"leaves"`
+	Proof      []HexBytes      `json:"proof"`
+	ProofFlags []bool          `json:"proofFlags"`
+}
+
+// standardTreeDump is the JSON dump of a StandardTree.
+type standardTreeDump struct {
+	Format       string          `json:"format"`
+	LeafEncoding []string        `json:"leafEncoding"`
+	Tree         []HexBytes      `json:"tree"`
+	Values       []StandardValue `json:"values"`
+}
+
+// NewStandardTree builds the StandardTree of the values, each value holding one element per type of leafEncoding.
+// Elements can be given as strings, booleans, integers, *big.Int, []byte or json.Number.
+func NewStandardTree(values [][]interface{}, leafEncoding []string) (*StandardTree, error) {
+	if len(values) == 0 {
+		return nil, ErrStandardTreeEmpty
+	}
+
+	t := &StandardTree{
+		LeafEncoding: leafEncoding,
+		Values:       make([]StandardValue, len(values)),
+	}
+
+	type hashedValue struct {
+		index int
+		hash  []byte
+	}
+	hashed := make([]hashedValue, len(values))
+	for i, value := range values {
+		normalized, err := normalizeStandardValue(leafEncoding, value)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := StandardLeafHash(leafEncoding, normalized)
+		if err != nil {
+			return nil, err
+		}
+		t.Values[i].Value = normalized
+		hashed[i] = hashedValue{index: i, hash: hash}
+	}
+	sort.SliceStable(hashed, func(i, j int) bool {
+		return bytes.Compare(hashed[i].hash, hashed[j].hash) < 0
+	})
+
+	// The leaves fill the end of the array in reverse order, as makeMerkleTree does.
+	t.Tree = make([]HexBytes, 2*len(values)-1)
+	for i, leaf := range hashed {
+		treeIndex := len(t.Tree) - 1 - i
+		t.Tree[treeIndex] = leaf.hash
+		t.Values[leaf.index].TreeIndex = treeIndex
+	}
+	for i := len(t.Tree) - 1 - len(values); i >= 0; i-- {
+		t.Tree[i] = standardHashPair(t.Tree[2*i+1], t.Tree[2*i+2])
+	}
+
+	t.indexLeaves()
+	return t, nil
+}
+
+// LoadStandardTree reads a StandardTree from its JSON dump, as written by Dump or by OpenZeppelin's library,
+// and checks that the tree matches its values.
+func LoadStandardTree(data []byte) (*StandardTree, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var dump standardTreeDump
+	if err := decoder.Decode(&dump); err != nil {
+		return nil, err
+	}
+	if dump.Format != StandardTreeFormat {
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidStandardTree, dump.Format)
+	}
+	if len(dump.Values) == 0 || len(dump.Tree) != 2*len(dump.Values)-1 {
+		return nil, ErrInvalidStandardTree
+	}
+
+	t := &StandardTree{
+		LeafEncoding: dump.LeafEncoding,
+		Tree:         dump.Tree,
+		Values:       dump.Values,
+	}
+	for i := range t.Values {
+		normalized, err := normalizeStandardValue(t.LeafEncoding, t.Values[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		t.Values[i].Value = normalized
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	t.indexLeaves()
+	return t, nil
+}
+
+// indexLeaves maps the leaves to their values.
+func (t *StandardTree) indexLeaves() {
+	t.leafIndex = make(map[string]int, len(t.Values))
+	for i, value := range t.Values {
+		t.leafIndex[string(t.Tree[value.TreeIndex])] = i
+	}
+}
+
+// Validate checks that every value is hashed into its leaf and that every node is the hash of its children.
+func (t *StandardTree) Validate() error {
+	firstLeaf := len(t.Tree) - len(t.Values)
+	for _, value := range t.Values {
+		if value.TreeIndex < firstLeaf || value.TreeIndex >= len(t.Tree) {
+			return ErrInvalidStandardTree
+		}
+		hash, err := StandardLeafHash(t.LeafEncoding, value.Value)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, t.Tree[value.TreeIndex]) {
+			return fmt.Errorf("%w: value does not match leaf %d", ErrInvalidStandardTree, value.TreeIndex)
+		}
+	}
+	for i := firstLeaf - 1; i >= 0; i-- {
+		if !bytes.Equal(t.Tree[i], standardHashPair(t.Tree[2*i+1], t.Tree[2*i+2])) {
+			return fmt.Errorf("%w: node %d does not match its children", ErrInvalidStandardTree, i)
+		}
+	}
+	return nil
+}
+
+// Root returns the Merkle root of the tree.
+func (t *StandardTree) Root() HexBytes {
+	return t.Tree[0]
+}
+
+// Dump encodes the tree in the JSON format of OpenZeppelin's StandardMerkleTree.dump.
+func (t *StandardTree) Dump() ([]byte, error) {
+	return json.Marshal(&standardTreeDump{
+		Format:       StandardTreeFormat,
+		LeafEncoding: t.LeafEncoding,
+		Tree:         t.Tree,
+		Values:       t.Values,
+	})
+}
+
+// Proof returns the proof of the value at the given index, for MerkleProof.verify.
+func (t *StandardTree) Proof(index int) ([]HexBytes, error) {
+	if index < 0 || index >= len(t.Values) {
+		return nil, ErrLeafIndexOutOfRange
+	}
+	var proof []HexBytes
+	for i := t.Values[index].TreeIndex; i > 0; i = (i - 1) / 2 {
+		proof = append(proof, t.Tree[standardSibling(i)])
+	}
+	return proof, nil
+}
+
+// MultiProof returns the proof of the values at the given indices, for MerkleProof.multiProofVerify.
+func (t *StandardTree) MultiProof(indices []int) (*StandardMultiProof, error) {
+	treeIndices := make([]int, len(indices))
+	for i, index := range indices {
+		if index < 0 || index >= len(t.Values) {
+			return nil, ErrLeafIndexOutOfRange
+		}
+		treeIndices[i] = t.Values[index].TreeIndex
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(treeIndices)))
+	for i := 1; i < len(treeIndices); i++ {
+		if treeIndices[i] == treeIndices[i-1] {
+			return nil, fmt.Errorf("%w: duplicated index", ErrInvalidRange)
+		}
+	}
+
+	multiProof := &StandardMultiProof{
+		Leaves:     make([][]interface{}, len(treeIndices)),
+		Proof:      []HexBytes{},
+		ProofFlags: []bool{},
+	}
+	for i, treeIndex := range treeIndices {
+		multiProof.Leaves[i] = t.Values[t.leafIndex[string(t.Tree[treeIndex])]].Value
+	}
+
+	// Walk up from the deepest nodes, using a proven node as the sibling whenever possible.
+	stack := append([]int{}, treeIndices...)
+	for len(stack) > 0 && stack[0] > 0 {
+		j := stack[0]
+		stack = stack[1:]
+		sibling := standardSibling(j)
+		if len(stack) > 0 && stack[0] == sibling {
+			multiProof.ProofFlags = append(multiProof.ProofFlags, true)
+			stack = stack[1:]
+		} else {
+			multiProof.ProofFlags = append(multiProof.ProofFlags, false)
+			multiProof.Proof = append(multiProof.Proof, t.Tree[sibling])
+		}
+		stack = append(stack, (j-1)/2)
+	}
+	if len(treeIndices) == 0 {
+		multiProof.Proof = append(multiProof.Proof, t.Tree[0])
+	}
+	return multiProof, nil
+}
+
+// StandardLeafHash computes the leaf of a value of a StandardTree, keccak256(keccak256(abi.encode(value))).
+// The elements of the value can be given in any of the forms accepted by NewStandardTree.
+func StandardLeafHash(leafEncoding []string, value []interface{}) ([]byte, error) {
+	normalized, err := normalizeStandardValue(leafEncoding, value)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := abiEncode(leafEncoding, normalized)
+	if err != nil {
+		return nil, err
+	}
+	return keccak256(keccak256(encoded)), nil
+}
+
+// VerifyStandardProof checks the proof of a value against the root of a StandardTree.
+func VerifyStandardProof(root []byte, leafEncoding []string, value []interface{}, proof []HexBytes) error {
+	result, err := StandardLeafHash(leafEncoding, value)
+	if err != nil {
+		return err
+	}
+	for _, sibling := range proof {
+		result = standardHashPair(result, sibling)
+	}
+	if !bytes.Equal(result, root) {
+		return ErrStandardProofInvalid
+	}
+	return nil
+}
+
+// VerifyStandardMultiProof checks a multiproof against the root of a StandardTree.
+func VerifyStandardMultiProof(root []byte, leafEncoding []string, multiProof *StandardMultiProof) error {
+	if multiProof == nil {
+		return ErrProofIsNil
+	}
+	if len(multiProof.Leaves)+len(multiProof.Proof) != len(multiProof.ProofFlags)+1 {
+		return ErrStandardProofInvalid
+	}
+
+	stack := make([][]byte, 0, len(multiProof.Leaves)+len(multiProof.ProofFlags))
+	for _, value := range multiProof.Leaves {
+		hash, err := StandardLeafHash(leafEncoding, value)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, hash)
+	}
+	proof := multiProof.Proof
+	for _, flag := range multiProof.ProofFlags {
+		if len(stack) == 0 {
+			return ErrStandardProofInvalid
+		}
+		a := stack[0]
+		stack = stack[1:]
+		var b []byte
+		if flag {
+			if len(stack) == 0 {
+				return ErrStandardProofInvalid
+			}
+			b, stack = stack[0], stack[1:]
+		} else {
+			if len(proof) == 0 {
+				return ErrStandardProofInvalid
+			}
+			b, proof = proof[0], proof[1:]
+		}
+		stack = append(stack, standardHashPair(a, b))
+	}
+
+	var result []byte
+	switch {
+	case len(stack) > 0:
+		result = stack[len(stack)-1]
+	case len(proof) > 0:
+		result = proof[0]
+	}
+	if !bytes.Equal(result, root) {
+		return ErrStandardProofInvalid
+	}
+	return nil
+}
+
+// standardHashPair hashes a sibling pair the way MerkleProof does, smaller node first.
+func standardHashPair(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return keccak256(a, b)
+}
+
+// standardSibling returns the index of the sibling of the node at index i of the tree array.
+func standardSibling(i int) int {
+	if i%2 == 1 {
+		return i + 1
+	}
+	return i - 1
+}
+
+// normalizeStandardValue converts the elements of a value to their JSON form, see StandardValue.
+func normalizeStandardValue(leafEncoding []string, value []interface{}) ([]interface{}, error) {
+	if len(value) != len(leafEncoding) {
+		return nil, fmt.Errorf("%w: %d elements for %d types", ErrInvalidLeafEncoding, len(value), len(leafEncoding))
+	}
+	normalized := make([]interface{}, len(value))
+	for i, element := range value {
+		abiType := leafEncoding[i]
+		if abiType == "bool" {
+			switch v := element.(type) {
+			case bool:
+				normalized[i] = v
+			case string:
+				parsed, err := strconv.ParseBool(v)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %q is not a bool", ErrInvalidLeafEncoding, v)
+				}
+				normalized[i] = parsed
+			default:
+				return nil, fmt.Errorf("%w: %v is not a bool", ErrInvalidLeafEncoding, element)
+			}
+			continue
+		}
+
+		switch v := element.(type) {
+		case string:
+			normalized[i] = v
+		case []byte:
+			normalized[i] = HexBytes(v).String()
+		case HexBytes:
+			normalized[i] = v.String()
+		case *big.Int:
+			normalized[i] = v.String()
+		case json.Number:
+			normalized[i] = v.String()
+		case int:
+			normalized[i] = strconv.FormatInt(int64(v), 10)
+		case int64:
+			normalized[i] = strconv.FormatInt(v, 10)
+		case uint64:
+			normalized[i] = strconv.FormatUint(v, 10)
+		default:
+			return nil, fmt.Errorf("%w: unsupported element %v", ErrInvalidLeafEncoding, element)
+		}
+	}
+	return normalized, nil
+}
+
+// abiEncode implements abi.encode for tuples of the elementary types bool, address, uintN, intN, bytesN,
+// bytes and string, with elements in the form produced by normalizeStandardValue.
+func abiEncode(types []string, value []interface{}) ([]byte, error) {
+	if len(types) != len(value) {
+		return nil, fmt.Errorf("%w: %d elements for %d types", ErrInvalidLeafEncoding, len(value), len(types))
+	}
+
+	// Static elements are encoded in place, dynamic ones in the tail with their offset in place.
+	head := make([]byte, 0, 32*len(types))
+	var tail []byte
+	for i, abiType := range types {
+		if abiType == "string" || abiType == "bytes" {
+			data, err := abiDynamicBytes(abiType, value[i])
+			if err != nil {
+				return nil, err
+			}
+			head = append(head, abiUint(big.NewInt(int64(32*len(types)+len(tail))))...)
+			tail = append(tail, abiUint(big.NewInt(int64(len(data))))...)
+			tail = append(tail, data...)
+			if pad := len(data) % 32; pad != 0 {
+				tail = append(tail, make([]byte, 32-pad)...)
+			}
+			continue
+		}
+		word, err := abiStaticWord(abiType, value[i])
+		if err != nil {
+			return nil, err
+		}
+		head = append(head, word...)
+	}
+	return append(head, tail...), nil
+}
+
+// abiDynamicBytes returns the content of a string or bytes element.
+func abiDynamicBytes(abiType string, element interface{}) ([]byte, error) {
+	s, ok := element.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v is not a %s", ErrInvalidLeafEncoding, element, abiType)
+	}
+	if abiType == "string" {
+		return []byte(s), nil
+	}
+	return decodeHex(s)
+}
+
+// abiStaticWord encodes a static element in a 32 byte word.
+func abiStaticWord(abiType string, element interface{}) ([]byte, error) {
+	if abiType == "bool" {
+		b, ok := element.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v is not a bool", ErrInvalidLeafEncoding, element)
+		}
+		if b {
+			return abiUint(big.NewInt(1)), nil
+		}
+		return abiUint(big.NewInt(0)), nil
+	}
+
+	s, ok := element.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v is not a %s", ErrInvalidLeafEncoding, element, abiType)
+	}
+
+	switch {
+	case abiType == "address":
+		data, err := decodeHex(s)
+		if err != nil || len(data) != 20 {
+			return nil, fmt.Errorf("%w: %q is not an address", ErrInvalidLeafEncoding, s)
+		}
+		return append(make([]byte, 12), data...), nil
+
+	case strings.HasPrefix(abiType, "bytes"):
+		size, err := strconv.Atoi(abiType[len("bytes"):])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidLeafEncoding, abiType)
+		}
+		data, err := decodeHex(s)
+		if err != nil || len(data) != size {
+			return nil, fmt.Errorf("%w: %q is not a %s", ErrInvalidLeafEncoding, s, abiType)
+		}
+		return append(data, make([]byte, 32-size)...), nil
+
+	case strings.HasPrefix(abiType, "uint"), strings.HasPrefix(abiType, "int"):
+		signed := strings.HasPrefix(abiType, "int")
+		bitSize := 256
+		if suffix := strings.TrimPrefix(strings.TrimPrefix(abiType, "u"), "int"); suffix != "" {
+			var err error
+			if bitSize, err = strconv.Atoi(suffix); err != nil || bitSize < 8 || bitSize > 256 || bitSize%8 != 0 {
+				return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidLeafEncoding, abiType)
+			}
+		}
+		n, ok := parseAbiInteger(s)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not an integer", ErrInvalidLeafEncoding, s)
+		}
+		if signed {
+			limit := new(big.Int).Lsh(big.NewInt(1), uint(bitSize-1))
+			if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+				return nil, fmt.Errorf("%w: %s is out of range of %s", ErrInvalidLeafEncoding, s, abiType)
+			}
+			if n.Sign() < 0 {
+				// Two's complement over 256 bits.
+				n.Add(n, new(big.Int).Lsh(big.NewInt(1), 256))
+			}
+			return abiUint(n), nil
+		}
+		if n.Sign() < 0 || n.BitLen() > bitSize {
+			return nil, fmt.Errorf("%w: %s is out of range of %s", ErrInvalidLeafEncoding, s, abiType)
+		}
+		return abiUint(n), nil
+	}
+	return nil, fmt.Errorf("%w: unsupported type %s", ErrInvalidLeafEncoding, abiType)
+}
+
+// parseAbiInteger parses a decimal or 0x prefixed hex integer with an optional minus sign, the way
+// ethers parses numeric strings. Octal and binary prefixes and _ separators are rejected.
+func parseAbiInteger(s string) (*big.Int, bool) {
+	digits := strings.TrimPrefix(s, "-")
+	if strings.HasPrefix(digits, "0x") || strings.HasPrefix(digits, "0X") {
+		n, ok := new(big.Int).SetString(digits[2:], 16)
+		if !ok {
+			return nil, false
+		}
+		if len(digits) != len(s) {
+			n.Neg(n)
+		}
+		return n, true
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+// abiUint encodes a non-negative integer of at most 256 bits in a 32 byte word.
+func abiUint(n *big.Int) []byte {
+	word := make([]byte, 32)
+	n.FillBytes(word)
+	return word
+}
+
+// decodeHex decodes a 0x prefixed hex string.
+func decodeHex(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("%w: %q is not 0x prefixed hex", ErrInvalidLeafEncoding, s)
+	}
+	return hex.DecodeString(s[2:])
+}
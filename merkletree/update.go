@@ -0,0 +1,173 @@
+package merkletree
+
+import (
+	"math/bits"
+)
+
+// Update replaces the data block at the given index and recomputes only the nodes on its path to the root.
+// It returns the new proof of the data block.
+// This method is only available when the configuration mode is ModeTreeBuild or ModeProofGenAndTreeBuild.
+// Proofs generated while building the tree are dropped because an update changes most of them,
+// use Proof or ProofAt to get fresh ones.
+func (m *MerkleTree) Update(idx int, dataBlock DataBlock) (*Proof, error) {
+	if m.Mode != ModeTreeBuild && m.Mode != ModeProofGenAndTreeBuild {
+		return nil, ErrProofInvalidModeTreeNotBuilt
+	}
+	if m.isKary() {
+		return nil, ErrArityUnsupported
+	}
+	if dataBlock == nil {
+		return nil, ErrDataBlockIsNil
+	}
+	if idx < 0 || idx >= m.NumLeaves {
+		return nil, ErrLeafIndexOutOfRange
+	}
+
+	leaf, err := dataBlockToLeaf(dataBlock, &m.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	m.leafMapMu.Lock()
+	if current, ok := m.leafMap[string(m.Leaves[idx])]; ok && current == idx {
+		delete(m.leafMap, string(m.Leaves[idx]))
+	}
+	m.leafMap[string(leaf)] = idx
+	m.leafMapMu.Unlock()
+
+	m.Leaves[idx] = leaf
+	if err = m.rehash(idx, idx); err != nil {
+		return nil, err
+	}
+	return m.proofAt(idx), nil
+}
+
+// Append adds the data block as the last leaf of the tree and recomputes only the nodes on its path to the root,
+// growing the tree by one level when needed. It returns the proof of the new data block.
+// The data block has no key, so Keys is left unchanged.
+// This method is only available when the configuration mode is ModeTreeBuild or ModeProofGenAndTreeBuild.
+func (m *MerkleTree) Append(dataBlock DataBlock) (*Proof, error) {
+	if m.Mode != ModeTreeBuild && m.Mode != ModeProofGenAndTreeBuild {
+		return nil, ErrProofInvalidModeTreeNotBuilt
+	}
+	if m.isKary() {
+		return nil, ErrArityUnsupported
+	}
+	if dataBlock == nil {
+		return nil, ErrDataBlockIsNil
+	}
+
+	leaf, err := dataBlockToLeaf(dataBlock, &m.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := m.NumLeaves
+	m.leafMapMu.Lock()
+	m.leafMap[string(leaf)] = idx
+	m.leafMapMu.Unlock()
+
+	m.Leaves = append(m.Leaves, leaf)
+	m.NumLeaves++
+	if err = m.rehash(idx, idx); err != nil {
+		return nil, err
+	}
+	return m.proofAt(idx), nil
+}
+
+// Remove deletes the leaf at the given index, along with its key when the tree was built from a map.
+// The following leaves move one position to the left, so the nodes to the right of the removed leaf are
+// recomputed; removing the last leaf only recomputes its path to the root.
+// This method is only available when the configuration mode is ModeTreeBuild or ModeProofGenAndTreeBuild.
+func (m *MerkleTree) Remove(idx int) error {
+	if m.Mode != ModeTreeBuild && m.Mode != ModeProofGenAndTreeBuild {
+		return ErrProofInvalidModeTreeNotBuilt
+	}
+	if m.isKary() {
+		return ErrArityUnsupported
+	}
+	if idx < 0 || idx >= m.NumLeaves {
+		return ErrLeafIndexOutOfRange
+	}
+	if m.NumLeaves <= 2 {
+		return ErrInvalidNumOfDataBlocks
+	}
+
+	m.leafMapMu.Lock()
+	if current, ok := m.leafMap[string(m.Leaves[idx])]; ok && current == idx {
+		delete(m.leafMap, string(m.Leaves[idx]))
+	}
+	m.Leaves = append(m.Leaves[:idx], m.Leaves[idx+1:]...)
+	for i := idx; i < len(m.Leaves); i++ {
+		m.leafMap[string(m.Leaves[i])] = i
+	}
+	m.leafMapMu.Unlock()
+
+	if len(m.Keys) == m.NumLeaves {
+		m.Keys = append(m.Keys[:idx], m.Keys[idx+1:]...)
+	}
+	m.NumLeaves--
+
+	// Removing the last leaf leaves nothing to shift, only the new last leaf's path has to be recomputed.
+	from := idx
+	if from == m.NumLeaves {
+		from--
+	}
+	return m.rehash(from, m.NumLeaves-1)
+}
+
+// rehash recomputes the tree nodes above the leaves in [from, to], resizing the levels to the current number of
+// leaves, and then the root. Levels added on top of the tree are computed entirely.
+func (m *MerkleTree) rehash(from, to int) (err error) {
+	// The cached proofs no longer match the tree.
+	m.Proofs = nil
+
+	m.Depth = bits.Len(uint(m.NumLeaves - 1))
+	builtLevels := len(m.nodes)
+	if builtLevels > m.Depth {
+		m.nodes = m.nodes[:m.Depth]
+	}
+
+	count := m.NumLeaves
+	for i := 0; i < m.Depth; i++ {
+		if i >= builtLevels {
+			m.nodes = append(m.nodes, nil)
+			from = 0
+		}
+
+		// Resize the level to its padded length.
+		length := count + count&1
+		if cap(m.nodes[i]) >= length {
+			m.nodes[i] = m.nodes[i][:length]
+		} else {
+			m.nodes[i] = append(m.nodes[i], make([][]byte, length-len(m.nodes[i]))...)
+		}
+
+		if to >= count {
+			to = count - 1
+		}
+		for j := from; j <= to; j++ {
+			if i == 0 {
+				m.nodes[i][j] = m.Leaves[j]
+				continue
+			}
+			if m.nodes[i][j], err = m.HashFunc(
+				m.concatHashFunc(m.nodes[i-1][j<<1], m.nodes[i-1][j<<1+1]),
+			); err != nil {
+				return
+			}
+		}
+
+		// Duplicate the last node of an odd level, as fixOddLength does.
+		if count&1 == 1 {
+			m.nodes[i][count] = m.nodes[i][count-1]
+		}
+
+		from >>= 1
+		to >>= 1
+		count = length >> 1
+	}
+
+	m.Root, err = m.HashFunc(m.concatHashFunc(m.nodes[m.Depth-1][0], m.nodes[m.Depth-1][1]))
+	return
+}
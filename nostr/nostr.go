@@ -0,0 +1,366 @@
+package nostr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+
+	"github.com/HORNET-Storage/scionic-merkletree/dag"
+	"github.com/HORNET-Storage/scionic-merkletree/merkletree"
+)
+
+// Regular event kind announcing the root leaf of a dag
+const KindDagRoot = 4848
+
+const (
+	CidTag              = "cid"
+	NameTag             = "name"
+	LeafCountTag        = "leaf_count"
+	LatestLabelTag      = "latest_label"
+	ChunkSizeTag        = "chunk_size"
+	HashTag             = "hash"
+	MerkleHashSchemeTag = "merkle_hash_scheme"
+	DataTag             = "data"
+)
+
+// Leaves are hashed into sha256 CIDs
+const HashAlgorithm = "sha256"
+
+var merkleHashSchemes = map[merkletree.TypeHashScheme]string{
+	merkletree.HashSchemeLegacy:  "legacy",
+	merkletree.HashSchemeRFC6962: "rfc6962",
+}
+
+// NIP-01 event
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// Root leaf announced by an event whose id and signature have been verified
+type RootReference struct {
+	Root             string
+	ItemName         string
+	LeafCount        int
+	LatestLabel      string
+	AdditionalData   map[string]string
+	ChunkSize        int
+	HashAlgorithm    string
+	MerkleHashScheme merkletree.TypeHashScheme
+	PubKey           string
+	CreatedAt        time.Time
+}
+
+// Wraps the root leaf into an event signed with the schnorr signer, the chunk size is the current dag.ChunkSize
+func NewRootEvent(leaf *dag.DagLeaf, signer dag.Signer) (*Event, error) {
+	if signer.Type() != dag.SchnorrSignatureType {
+		return nil, fmt.Errorf("nostr events must be signed with a schnorr signer")
+	}
+
+	if dag.HasLabel(leaf.Hash) {
+		return nil, fmt.Errorf("leaf %s is not a root leaf", leaf.Hash)
+	}
+
+	scheme, exists := merkleHashSchemes[leaf.MerkleHashScheme]
+	if !exists {
+		return nil, fmt.Errorf("unknown merkle hash scheme %d", leaf.MerkleHashScheme)
+	}
+
+	tags := [][]string{
+		{CidTag, leaf.Hash},
+		{NameTag, leaf.ItemName},
+		{LeafCountTag, strconv.Itoa(leaf.LeafCount)},
+		{LatestLabelTag, leaf.LatestLabel},
+		{ChunkSizeTag, strconv.Itoa(dag.ChunkSize)},
+		{HashTag, HashAlgorithm},
+		{MerkleHashSchemeTag, scheme},
+	}
+
+	keys := make([]string, 0, len(leaf.AdditionalData))
+	for key := range leaf.AdditionalData {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		tags = append(tags, []string{DataTag, key, leaf.AdditionalData[key]})
+	}
+
+	event := &Event{
+		PubKey:    hex.EncodeToString(signer.PublicKey()),
+		CreatedAt: time.Now().Unix(),
+		Kind:      KindDagRoot,
+		Tags:      tags,
+		Content:   "",
+	}
+
+	id := event.Hash()
+
+	sig, err := signer.Sign(id)
+	if err != nil {
+		return nil, err
+	}
+
+	event.ID = hex.EncodeToString(id)
+	event.Sig = hex.EncodeToString(sig)
+
+	return event, nil
+}
+
+// Serialization of the event that is hashed into its id, as defined by NIP-01
+func (e *Event) Serialize() []byte {
+	var b strings.Builder
+
+	b.WriteString(`[0,`)
+	writeString(&b, e.PubKey)
+	b.WriteString(`,`)
+	b.WriteString(strconv.FormatInt(e.CreatedAt, 10))
+	b.WriteString(`,`)
+	b.WriteString(strconv.Itoa(e.Kind))
+	b.WriteString(`,[`)
+	for i, tag := range e.Tags {
+		if i > 0 {
+			b.WriteString(`,`)
+		}
+		b.WriteString(`[`)
+		for j, value := range tag {
+			if j > 0 {
+				b.WriteString(`,`)
+			}
+			writeString(&b, value)
+		}
+		b.WriteString(`]`)
+	}
+	b.WriteString(`],`)
+	writeString(&b, e.Content)
+	b.WriteString(`]`)
+
+	return []byte(b.String())
+}
+
+// NIP-01 escapes line breaks, tabs, backspaces, form feeds, quotes and backslashes by name and the
+// other control characters as \u00XX with lowercase hex, the way JSON.stringify does
+func writeString(b *strings.Builder, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\n':
+			b.WriteString(`\n`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
+
+func (e *Event) Hash() []byte {
+	hash := sha256.Sum256(e.Serialize())
+	return hash[:]
+}
+
+// Checks the id and the signature of the event
+func (e *Event) Verify() error {
+	id := e.Hash()
+	if e.ID != hex.EncodeToString(id) {
+		return fmt.Errorf("event id does not match its content")
+	}
+
+	pubkeyBytes, err := hex.DecodeString(e.PubKey)
+	if err != nil {
+		return fmt.Errorf("could not decode event pubkey: %w", err)
+	}
+
+	pubkey, err := schnorr.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		return fmt.Errorf("could not parse event pubkey: %w", err)
+	}
+
+	sigBytes, err := hex.DecodeString(e.Sig)
+	if err != nil {
+		return fmt.Errorf("could not decode event signature: %w", err)
+	}
+
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return fmt.Errorf("could not parse event signature: %w", err)
+	}
+
+	if !sig.Verify(id, pubkey) {
+		return fmt.Errorf("invalid event signature")
+	}
+
+	return nil
+}
+
+func ParseEvent(data []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("could not decode event: %w", err)
+	}
+
+	return &event, nil
+}
+
+// Verifies the event and reads the root it announces, when trusted public keys are given
+// the event must be signed by one of them
+func (e *Event) RootReference(trustedPubkeys ...string) (*RootReference, error) {
+	if e.Kind != KindDagRoot {
+		return nil, fmt.Errorf("event kind %d is not a dag root", e.Kind)
+	}
+
+	if len(trustedPubkeys) > 0 {
+		trusted := false
+		for _, pubkey := range trustedPubkeys {
+			if strings.EqualFold(pubkey, e.PubKey) {
+				trusted = true
+				break
+			}
+		}
+
+		if !trusted {
+			return nil, fmt.Errorf("event is not signed by a trusted pubkey")
+		}
+	}
+
+	err := e.Verify()
+	if err != nil {
+		return nil, err
+	}
+
+	ref := &RootReference{
+		PubKey:    e.PubKey,
+		CreatedAt: time.Unix(e.CreatedAt, 0),
+	}
+
+	seen := map[string]bool{}
+	for _, tag := range e.Tags {
+		if len(tag) == 0 {
+			continue
+		}
+
+		if tag[0] == DataTag {
+			if len(tag) != 3 {
+				return nil, fmt.Errorf("data tag must have a key and a value")
+			}
+
+			if ref.AdditionalData == nil {
+				ref.AdditionalData = map[string]string{}
+			}
+
+			ref.AdditionalData[tag[1]] = tag[2]
+			continue
+		}
+
+		if len(tag) != 2 {
+			continue
+		}
+
+		if seen[tag[0]] {
+			return nil, fmt.Errorf("duplicate %s tag", tag[0])
+		}
+		seen[tag[0]] = true
+
+		switch tag[0] {
+		case CidTag:
+			ref.Root = tag[1]
+		case NameTag:
+			ref.ItemName = tag[1]
+		case LeafCountTag:
+			ref.LeafCount, err = strconv.Atoi(tag[1])
+		case LatestLabelTag:
+			ref.LatestLabel = tag[1]
+		case ChunkSizeTag:
+			ref.ChunkSize, err = strconv.Atoi(tag[1])
+		case HashTag:
+			ref.HashAlgorithm = tag[1]
+		case MerkleHashSchemeTag:
+			found := false
+			for scheme, name := range merkleHashSchemes {
+				if name == tag[1] {
+					ref.MerkleHashScheme = scheme
+					found = true
+				}
+			}
+
+			if !found {
+				err = fmt.Errorf("unknown merkle hash scheme %q", tag[1])
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s tag: %w", tag[0], err)
+		}
+	}
+
+	for _, required := range []string{CidTag, LeafCountTag, ChunkSizeTag, HashTag} {
+		if !seen[required] {
+			return nil, fmt.Errorf("event is missing the %s tag", required)
+		}
+	}
+
+	if ref.HashAlgorithm != HashAlgorithm {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", ref.HashAlgorithm)
+	}
+
+	if dag.HasLabel(ref.Root) {
+		return nil, fmt.Errorf("cid %s is not a root", ref.Root)
+	}
+
+	return ref, nil
+}
+
+// Checks that the root leaf is the one the reference announces
+func (ref *RootReference) VerifyLeaf(leaf *dag.DagLeaf) error {
+	if leaf.Hash != ref.Root {
+		return fmt.Errorf("leaf %s is not the announced root %s", leaf.Hash, ref.Root)
+	}
+
+	err := leaf.VerifyRootLeaf()
+	if err != nil {
+		return err
+	}
+
+	if leaf.ItemName != ref.ItemName || leaf.LeafCount != ref.LeafCount || leaf.LatestLabel != ref.LatestLabel || leaf.MerkleHashScheme != ref.MerkleHashScheme {
+		return fmt.Errorf("leaf does not match the announced root")
+	}
+
+	if len(leaf.AdditionalData) != len(ref.AdditionalData) {
+		return fmt.Errorf("leaf additional data does not match the announced root")
+	}
+
+	for key, value := range leaf.AdditionalData {
+		if announced, exists := ref.AdditionalData[key]; !exists || announced != value {
+			return fmt.Errorf("leaf additional data does not match the announced root")
+		}
+	}
+
+	return nil
+}
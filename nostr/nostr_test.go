@@ -0,0 +1,135 @@
+package nostr
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HORNET-Storage/scionic-merkletree/dag"
+)
+
+func createSigner(t *testing.T) dag.Signer {
+	privateKey := make([]byte, 32)
+	_, err := rand.Read(privateKey)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	signer, err := dag.NewSchnorrSigner(privateKey)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	return signer
+}
+
+func TestRootEvent(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %s", err)
+	}
+
+	defer os.RemoveAll(tmpDir)
+
+	dag.GenerateDummyDirectory(filepath.Join(tmpDir, "input"), 3, 2)
+
+	d, err := dag.CreateDagAdvanced(filepath.Join(tmpDir, "input"), map[string]string{"note": "line\nbreak \"quoted\""})
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	rootLeaf := d.Leafs[d.Root]
+	signer := createSigner(t)
+
+	event, err := NewRootEvent(rootLeaf, signer)
+	if err != nil {
+		t.Fatalf("Could not create event: %s", err)
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	parsed, err := ParseEvent(data)
+	if err != nil {
+		t.Fatalf("Could not parse event: %s", err)
+	}
+
+	ref, err := parsed.RootReference(hex.EncodeToString(signer.PublicKey()))
+	if err != nil {
+		t.Fatalf("Event failed to validate: %s", err)
+	}
+
+	if ref.Root != d.Root || ref.ChunkSize != dag.ChunkSize || ref.AdditionalData["note"] != rootLeaf.AdditionalData["note"] {
+		t.Fatal("Root reference does not match the root leaf")
+	}
+
+	err = ref.VerifyLeaf(rootLeaf)
+	if err != nil {
+		t.Fatalf("Root leaf does not match its reference: %s", err)
+	}
+
+	_, err = parsed.RootReference(hex.EncodeToString(createSigner(t).PublicKey()))
+	if err == nil {
+		t.Fatal("Event validated for an untrusted pubkey")
+	}
+
+	tampered := *parsed
+	tampered.Tags = append([][]string{{CidTag, "tampered"}}, parsed.Tags[1:]...)
+	_, err = tampered.RootReference()
+	if err == nil {
+		t.Fatal("Tampered event validated")
+	}
+
+	forged := *parsed
+	forged.ID = hex.EncodeToString(forged.Hash())
+	forged.CreatedAt++
+	_, err = forged.RootReference()
+	if err == nil {
+		t.Fatal("Event with a stale id validated")
+	}
+
+	for _, leaf := range d.Leafs {
+		if leaf.Hash != d.Root {
+			_, err = NewRootEvent(leaf, signer)
+			if err == nil {
+				t.Fatal("Created an event for a leaf that is not a root")
+			}
+			break
+		}
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	event := &Event{
+		PubKey:    "abc",
+		CreatedAt: 1,
+		Kind:      KindDagRoot,
+		Tags:      [][]string{{"a", "<b>"}, {}},
+		Content:   "tab\there \\ \"quote\" é",
+	}
+
+	expected := `[0,"abc",1,4848,[["a","<b>"],[]],"tab\there \\ \"quote\" é"]`
+	if string(event.Serialize()) != expected {
+		t.Fatalf("Unexpected serialization %s", event.Serialize())
+	}
+
+	// Other control characters are escaped as \u00XX, so the serialization stays valid JSON
+	event.Content = "bell\x07 esc\x1b del\x7f"
+
+	expected = `[0,"abc",1,4848,[["a","<b>"],[]],"bell\u0007 esc\u001b del` + "\x7f" + `"]`
+	if string(event.Serialize()) != expected {
+		t.Fatalf("Unexpected serialization %s", event.Serialize())
+	}
+
+	var decoded []interface{}
+	err := json.Unmarshal(event.Serialize(), &decoded)
+	if err != nil || decoded[5] != event.Content {
+		t.Fatalf("Serialization is not valid JSON: %s", err)
+	}
+}
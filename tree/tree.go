@@ -9,6 +9,7 @@ import (
 
 type TreeContent struct {
 	leafs map[string]mt.DataBlock
+	keys  []string
 }
 
 type Leaf struct {
@@ -22,6 +23,7 @@ func (b *Leaf) Serialize() ([]byte, error) {
 func CreateTree() *TreeContent {
 	tree := TreeContent{
 		map[string]mt.DataBlock{},
+		[]string{},
 	}
 
 	return &tree
@@ -34,11 +36,19 @@ func CreateLeaf(data string) *Leaf {
 func (tc *TreeContent) AddLeaf(key string, data string) {
 	leaf := CreateLeaf(data)
 
+	if _, exists := tc.leafs[key]; !exists {
+		tc.keys = append(tc.keys, key)
+	}
+
 	tc.leafs[key] = leaf
 }
 
 func (tc *TreeContent) Build() (*mt.MerkleTree, map[string]mt.DataBlock, error) {
-	tree, err := mt.New(nil, tc.leafs)
+	return tc.BuildWithConfig(nil)
+}
+
+func (tc *TreeContent) BuildWithConfig(config *mt.Config) (*mt.MerkleTree, map[string]mt.DataBlock, error) {
+	tree, err := mt.New(config, tc.leafs)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -46,6 +56,23 @@ func (tc *TreeContent) Build() (*mt.MerkleTree, map[string]mt.DataBlock, error)
 	return tree, tc.leafs, err
 }
 
+// BuildInOrder builds the tree from the leaves in the order they were added instead of sorting their keys
+func (tc *TreeContent) BuildInOrder(config *mt.Config) (*mt.MerkleTree, []mt.DataBlock, error) {
+	blocks := make([]mt.DataBlock, 0, len(tc.keys))
+	for _, key := range tc.keys {
+		blocks = append(blocks, tc.leafs[key])
+	}
+
+	tree, err := mt.NewFromSlice(config, blocks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tree.Keys = tc.keys
+
+	return tree, blocks, nil
+}
+
 func VerifyTree(tree *mt.MerkleTree, leafs []mt.DataBlock) bool {
 	result := true
 